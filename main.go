@@ -1,324 +1,5581 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/textproto"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+var MaxSourceLength = 4096
+var MaxSourceSubjectLength = 0
+var MaxIDLength = 0
+var SubjectPattern *regexp.Regexp
+var MaxDepth = 64
+var StrictJSON = false
+var MaxHeaders = 100
+var MaxFindings = 0
+var IDWindowSize = 0
+var ReadTrailers = false
+var Redact = false
+var MaxDataSize = 0
+var SubjectDataSize = 0
+var CanonicalOrder = false
+var ValidateXMLData = false
+
+var ReadHeaderTimeout = 10 * time.Second
+var ReadTimeout = 30 * time.Second
+var WriteTimeout = 30 * time.Second
+var EventTimeout time.Duration = 0
+
+var Strict = false
+var Debug = false
+var RequireTLS = false
+var Verbose = false
+var Only = ""
+var AssertInvalid = false
+var ReportPassing = false
+var EchoAttributes = false
+var ExplainErrors = false
+var Output = "text"
+var JSONPointer = ""
+var CompactJSON = false
+var JSONIndent = "  "
+var Format = "auto"
+var MaxBodySize int64 = 10 << 20
+
+var ErrBodyTooLarge = errors.New("body is larger than the maximum body size")
+var ErrNoInput = errors.New("no input provided on stdin")
+var ErrNoSSEEvents = errors.New("no events in the Server-Sent Events stream")
+var ErrTLSRequired = errors.New("-require-tls needs a certificate and key given with -crt and -key")
+
+const (
+	MissingRequired  = "missing_required"
+	NullValue        = "null_value"
+	WrongType        = "wrong_type"
+	EmptyString      = "empty_string"
+	EmptyMap         = "empty_map"
+	InvalidURI       = "invalid_uri"
+	NotAbsoluteURI   = "not_absolute_uri"
+	TooLong          = "too_long"
+	InvalidTimestamp = "invalid_timestamp"
+	InvalidEncoding  = "invalid_encoding"
+	InvalidMediaType = "invalid_media_type"
+	BadExtensionName = "bad_extension_name"
+	BadHeader        = "bad_header"
+
+	ContentTypeWithoutData = "content_type_without_data"
+	DuplicateAttribute     = "duplicate_attribute"
+	EncodingWithoutData    = "encoding_without_data"
+	PatternMismatch        = "pattern_mismatch"
+
+	InconsistentSpecVersion     = "inconsistent_specversion"
+	MalformedMediaTypeParameter = "malformed_media_type_parameter"
+	WrongProvenance             = "wrong_provenance"
+	WrongVersion                = "wrong_version"
+	UppercaseScheme             = "uppercase_scheme"
+	CaseVariant                 = "case_variant"
+	ExcessPrecision             = "excess_precision"
+	ConflictingAttribute        = "conflicting_attribute"
+	MissingContentType          = "missing_content_type"
+	SuspiciousString            = "suspicious_string"
+	NonASCII                    = "non_ascii"
+	OutOfOrder                  = "out_of_order"
+	InvalidXML                  = "invalid_xml"
+	DuplicateID                 = "duplicate_id"
+	UnregisteredType            = "unregistered_type"
+	DataTooLarge                = "data_too_large"
+	MissingSubject              = "missing_subject"
+	InvalidBase64               = "invalid_base64"
+	DataNotAllowed              = "data_not_allowed"
+	SchemaViolation             = "schema_violation"
+	ReservedName                = "reserved_name"
+	UnsupportedFormat           = "unsupported_format"
+	InvalidURN                  = "invalid_urn"
+	MissingHost                 = "missing_host"
+	OutOfRange                  = "out_of_range"
+	Timeout                     = "timeout"
+	SentinelTime                = "sentinel_time"
+	Truncated                   = "truncated"
+)
+
+type Finding struct {
+	Code      string `json:"code"`
+	Attribute string `json:"attribute,omitempty"`
+	Message   string `json:"message"`
+}
+
+type Result struct {
+	Valid      bool                   `json:"valid"`
+	Error      string                 `json:"error,omitempty"`
+	Findings   []Finding              `json:"findings"`
+	Passed     []string               `json:"passed,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+
+	// codes are those of all the findings, including any beyond -max-findings
+	codes []string
+}
+
+type BatchResult struct {
+	Valid    bool      `json:"valid"`
+	Findings []Finding `json:"findings"`
+	Events   []Result  `json:"events"`
+}
+
+func NewFinding(code string, attribute string, message string) *Finding {
+	if m, ok := Catalog[code]; ok && (attribute != "" || !strings.Contains(m, "{attribute}")) {
+		message = strings.ReplaceAll(m, "{attribute}", attribute)
+	}
+	if Redact && IsData(attribute) && (code == InvalidXML || code == SchemaViolation) {
+		// the details of these quote parts of the data
+		if i := strings.Index(message, " ("); i >= 0 {
+			message = message[:i] + " (details redacted)"
+		}
+	}
+	return &Finding{Code: code, Attribute: attribute, Message: message}
+}
+
+func IsData(k string) bool {
+	return k == "data" || k == "data_base64"
+}
+
+// Redacted copies j with the data replaced by its size, for -redact.
+func Redacted(j map[string]interface{}) map[string]interface{} {
+	r := make(map[string]interface{}, len(j))
+	for k, v := range j {
+		if IsData(k) && v != nil {
+			v = fmt.Sprintf("[redacted %d bytes]", DataSize(v))
+		}
+		r[k] = v
+	}
+	return r
+}
+
+//go:embed locales
+var Locales embed.FS
+
+// Catalog maps finding codes to the messages of the -locale, nil for English.
+// A message replaces the English one, which has more detail, with
+// "{attribute}" standing for the name of the attribute.
+var Catalog map[string]string
+
+// LoadLocale loads the bundled catalog of locale, "en" being the messages of
+// the code itself.
+func LoadLocale(locale string) (map[string]string, error) {
+	if locale == "en" {
+		return nil, nil
+	}
+
+	body, err := Locales.ReadFile("locales/" + locale + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown locale %q (known are %s)", locale, strings.Join(KnownLocales(), ", "))
+	}
+
+	var catalog map[string]string
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+func KnownLocales() []string {
+	locales := []string{"en"}
+	entries, _ := Locales.ReadDir("locales")
+	for _, e := range entries {
+		locales = append(locales, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+type SpecReference struct {
+	Section string
+	URL     string
+}
+
+const SpecURL = "https://github.com/cloudevents/spec/blob/master/spec.md"
+
+// SpecReferences is keyed by finding code first and attribute name second.
+var SpecReferences = map[string]SpecReference{
+	"id":                  {"Context Attributes: id", SpecURL + "#id"},
+	"source":              {"Context Attributes: source", SpecURL + "#source-1"},
+	"specversion":         {"Context Attributes: specversion", SpecURL + "#specversion"},
+	"type":                {"Context Attributes: type", SpecURL + "#type"},
+	"datacontentencoding": {"Context Attributes: datacontentencoding", SpecURL + "#datacontentencoding"},
+	"datacontenttype":     {"Context Attributes: datacontenttype", SpecURL + "#datacontenttype"},
+	"schemaurl":           {"Context Attributes: schemaurl", SpecURL + "#schemaurl"},
+	"dataschema":          {"Context Attributes: dataschema", SpecURL + "#dataschema"},
+	"subject":             {"Context Attributes: subject", SpecURL + "#subject"},
+	"time":                {"Context Attributes: time", SpecURL + "#time"},
+	BadExtensionName:      {"Attribute Naming Convention", SpecURL + "#attribute-naming-convention"},
+	CaseVariant:           {"Attribute Naming Convention", SpecURL + "#attribute-naming-convention"},
+}
+
+var ExtensionReference = SpecReference{"Extension Context Attributes", SpecURL + "#extension-context-attributes"}
+
+func Explain(f Finding) string {
+	if !ExplainErrors {
+		return f.Message
+	}
+
+	r, ok := SpecReferences[f.Code]
+	if !ok {
+		r, ok = SpecReferences[f.Attribute]
+	}
+	if !ok && f.Attribute != "" && !IsAttribute(f.Attribute) {
+		r, ok = ExtensionReference, true
+	}
+	if !ok {
+		return f.Message
+	}
+
+	return f.Message + " (see \"" + r.Section + "\": " + r.URL + ")"
+}
+
+func FormatFindings(findings []Finding) string {
+	// most events are valid, which needs no building at all
+	if len(findings) == 0 {
+		return ""
+	}
+
+	var reason strings.Builder
+	for _, f := range findings {
+		reason.WriteString(Explain(f))
+		reason.WriteByte('\n')
+	}
+
+	return reason.String()
+}
+
+type Rules struct {
+	Extensions map[string]string `json:"extensions"`
+	Types      []TypeRule        `json:"types"`
+	NoData     []string          `json:"nodata"`
+}
+
+// TypeRule requires extensions of the events whose type matches Pattern.
+type TypeRule struct {
+	Pattern  string   `json:"pattern"`
+	Required []string `json:"required"`
+
+	pattern *regexp.Regexp
+}
+
+var LoadedRules Rules
+
+var ExtensionTypes = map[string]func(map[string]interface{}, string) *Finding{
+	"Binary":        CheckBase64,
+	"Boolean":       CheckBoolean,
+	"Integer":       CheckInteger,
+	"String":        CheckString,
+	"URI":           CheckAbsoluteURI,
+	"URI-reference": CheckURIReference,
+}
+
+// ReservedNames are extension names whose `ce-` header receivers of an older
+// specification or an HTTP stack may treat specially, with the reason why.
+// Attributes of another specversion than that of an event are risky too.
+var ReservedNames = map[string]string{
+	"cloudeventsversion": "is the header of the specversion of 0.1",
+	"contenttype":        "is the header of the datacontenttype of 0.2, which binary mode carries in `Content-Type`",
+	"eventid":            "is the header of the id of 0.1",
+	"eventtime":          "is the header of the time of 0.1",
+	"eventtype":          "is the header of the type of 0.1",
+	"eventtypeversion":   "is the header of an attribute of 0.1",
+	"extensions":         "is the header of the extension bag of 0.1",
+	"connection":         "is a standard HTTP header, which stacks that strip the `ce-` prefix confuse it with",
+	"date":               "is a standard HTTP header, which stacks that strip the `ce-` prefix confuse it with",
+	"expect":             "is a standard HTTP header, which stacks that strip the `ce-` prefix confuse it with",
+	"host":               "is a standard HTTP header, which stacks that strip the `ce-` prefix confuse it with",
+	"te":                 "is a standard HTTP header, which stacks that strip the `ce-` prefix confuse it with",
+	"trailer":            "is a standard HTTP header, which stacks that strip the `ce-` prefix confuse it with",
+	"upgrade":            "is a standard HTTP header, which stacks that strip the `ce-` prefix confuse it with",
+	"via":                "is a standard HTTP header, which stacks that strip the `ce-` prefix confuse it with",
+}
+
+// ReservedReason is why k is a risky extension name in j: one of the
+// ReservedNames or an attribute of another specversion than that of j.
+func ReservedReason(j map[string]interface{}, k string) (string, bool) {
+	if reason, ok := ReservedNames[k]; ok && !IsAttribute(k) {
+		return reason, true
+	}
+
+	for _, e := range Attributes {
+		if e.Name == k && CheckVersion(j, k, e.Versions) != nil {
+			return "is the header of the " + k + " of " + strings.Join(e.Versions, ", "), true
+		}
+	}
+
+	return "", false
+}
+
+// SpecVersions are the released versions of the specification whose
+// attribute sets are known; events of any other specversion may use every
+// attribute.
+var SpecVersions = []string{"0.3", "1.0"}
+
+// MemberVersions are the specversions of the members of the JSON format that
+// are not attributes but are also versioned like Attribute.Versions.
+var MemberVersions = map[string][]string{
+	"data_base64": {"1.0"},
+}
+
+// CheckVersion reports the attribute v if it is not part of the known
+// specversion of j.
+func CheckVersion(j map[string]interface{}, v string, versions []string) *Finding {
+	if version, _ := j["specversion"].(string); versions != nil && StringInSlice(version, SpecVersions) && !StringInSlice(version, versions) {
+		return NewFinding(WrongVersion, v, "Attribute `"+v+"` is not part of specversion "+version+" (it belongs to "+strings.Join(versions, ", ")+").")
+	}
+	return nil
+}
+
 type Attribute struct {
 	Name     string
+	Type     string
 	Required bool
-	Check    func(map[string]interface{}, string) string
+	Check    func(map[string]interface{}, string) *Finding
+	// Versions lists the SpecVersions the attribute is part of, nil for all.
+	Versions []string
 }
 
 var Attributes []Attribute = []Attribute{
 	{
 		Name:     "id",
+		Type:     "String",
 		Required: true,
-		Check:    CheckString,
+		Check:    CheckID,
 	},
 	{
 		Name:     "source",
+		Type:     "URI-reference",
 		Required: true,
-		Check:    CheckURI,
+		Check:    CheckSource,
 	},
 	{
 		Name:     "specversion",
+		Type:     "String",
 		Required: true,
-		Check:    CheckString,
+		Check:    CheckSpecVersion,
 	},
 	{
 		Name:     "type",
+		Type:     "String",
 		Required: true,
 		Check:    CheckString,
 	},
 	{
 		Name:     "datacontentencoding",
+		Type:     "Encoding",
 		Required: false,
 		Check:    CheckEncoding,
+		Versions: []string{"0.3"},
 	},
 	{
 		Name:     "datacontenttype",
+		Type:     "Media type",
 		Required: false,
 		Check:    CheckMediaType,
 	},
 	{
 		Name:     "schemaurl",
+		Type:     "URI",
 		Required: false,
-		Check:    CheckURI,
+		Check:    CheckAbsoluteURI,
+		Versions: []string{"0.3"},
+	},
+	{
+		Name:     "dataschema",
+		Type:     "URI",
+		Required: false,
+		Check:    CheckAbsoluteURI,
+		Versions: []string{"1.0"},
 	},
 	{
 		Name:     "subject",
+		Type:     "String",
 		Required: false,
-		Check:    CheckString,
+		Check:    CheckSubject,
 	},
 	{
 		Name:     "time",
+		Type:     "Timestamp",
 		Required: false,
 		Check:    CheckTimestamp,
 	},
 }
 
-func CheckVar(j map[string]interface{}, v string, t string) string {
-	if c := reflect.TypeOf(j[v]).String(); c != t {
-		return "Attribute `" + v + "` is not of type " + t + " (is currently of type " + c + ")"
-	}
-	return ""
+type EventCheck struct {
+	Name      string
+	Attribute string
+	// Code is that of the findings of Check.
+	Code   string
+	Strict bool
+	// Flag names the flag that has to be set for Check to do anything.
+	Flag  string
+	Check func(map[string]interface{}) *Finding
+	// Vector, if set, breaks the sample event so that Check reports it.
+	Vector func(map[string]interface{})
 }
 
-func CheckString(j map[string]interface{}, v string) string {
-	res := CheckVar(j, v, "string")
+var EventChecks []EventCheck = []EventCheck{
+	{
+		Name:      "`datacontenttype` is only set with data",
+		Attribute: "datacontenttype",
+		Code:      ContentTypeWithoutData,
+		Strict:    true,
+		Check:     CheckContentTypeWithoutData,
+		Vector:    func(j map[string]interface{}) { delete(j, "data") },
+	},
+	{
+		Name:   "string extensions do not look like booleans or integers",
+		Code:   SuspiciousString,
+		Strict: true,
+		Check:  CheckSuspiciousStrings,
+		Vector: func(j map[string]interface{}) { j["count"] = "42" },
+	},
+	{
+		Name:   "attribute values are ASCII so they can be HTTP headers as is",
+		Code:   NonASCII,
+		Strict: true,
+		Check:  CheckASCII,
+		Vector: func(j map[string]interface{}) { j["subject"] = "café" },
+	},
+	{
+		Name:      "`datacontentencoding` is only set with data (0.3)",
+		Attribute: "datacontentencoding",
+		Code:      EncodingWithoutData,
+		Strict:    false,
+		Check:     CheckEncodingWithoutData,
+		Vector: func(j map[string]interface{}) {
+			j["specversion"] = "0.3"
+			j["datacontentencoding"] = "base64"
+			delete(j, "data")
+		},
+	},
+	{
+		Name:      "there is no data for a `datacontenttype` of the rules' `nodata`",
+		Attribute: "datacontenttype",
+		Code:      DataNotAllowed,
+		Flag:      "-rules",
+		Check:     CheckNoData,
+	},
+	{
+		Name:      "`source` and `subject` together are not longer than -max-source-subject-length",
+		Attribute: "subject",
+		Code:      TooLong,
+		Flag:      "-max-source-subject-length",
+		Check:     CheckSourceSubjectLength,
+	},
+	{
+		Name:      "data is not larger than -max-data-size",
+		Attribute: "data",
+		Code:      DataTooLarge,
+		Flag:      "-max-data-size",
+		Check:     CheckDataSize,
+	},
+	{
+		Name:      "XML data is well-formed",
+		Attribute: "data",
+		Code:      InvalidXML,
+		Flag:      "-validate-xml-data",
+		Check:     CheckXMLData,
+	},
+	{
+		Name:      "`time` is not the zero time or the Unix epoch",
+		Attribute: "time",
+		Code:      SentinelTime,
+		Strict:    true,
+		Check:     CheckTimeSentinel,
+		Vector:    func(j map[string]interface{}) { j["time"] = "1970-01-01T00:00:00Z" },
+	},
+	{
+		Name:      "`subject` is set with data larger than -subject-data-size",
+		Attribute: "subject",
+		Code:      MissingSubject,
+		Strict:    true,
+		Flag:      "strict and -subject-data-size",
+		Check:     CheckSubjectWithData,
+	},
+}
 
-	if res == "" && len(j[v].(string)) == 0 {
-		return "Attribute `" + v + "` cannot be an empty string\n"
-	}
+type BatchCheck struct {
+	Name      string
+	Attribute string
+	Code      string
+	Strict    bool
+	Check     func([]map[string]interface{}) *Finding
+}
 
-	return res
+var BatchChecks []BatchCheck = []BatchCheck{
+	{
+		Name:      "all events of a batch share one `specversion`",
+		Attribute: "specversion",
+		Code:      InconsistentSpecVersion,
+		Strict:    true,
+		Check:     CheckBatchSpecVersion,
+	},
 }
 
-func CheckURI(j map[string]interface{}, v string) string {
-	if t := reflect.TypeOf(j[v]).String(); t != "string" {
-		return "Attribute `" + v + "` is not of type URI (is currently of type " + t + ")\n"
+func CheckBatchSpecVersion(events []map[string]interface{}) *Finding {
+	seen := make(map[string]bool)
+	var versions []string
+
+	for _, j := range events {
+		if v, ok := j["specversion"].(string); ok && !seen[v] {
+			seen[v] = true
+			versions = append(versions, strconv.Quote(v))
+		}
 	}
 
-	if len(j[v].(string)) == 0 {
-		return "Attribute `" + v + "` cannot be empty\n"
+	if len(versions) > 1 {
+		sort.Strings(versions)
+		return NewFinding(InconsistentSpecVersion, "specversion", "Batch mixes several values of `specversion` ("+strings.Join(versions, ", ")+")")
 	}
 
-	uri := j[v].(string)
-	valids := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~:/?#[]@!$&'()*+,;="
+	return nil
+}
 
-	for i := 0; i < len(uri); i++ {
-		if !strings.Contains(valids, string(uri[i])) {
-			return "Attribute `" + v + "` is not a valid URI (contains illegal character '" + string(uri[i]) + "')"
-		}
+type CheckInfo struct {
+	Name      string   `json:"name"`
+	Attribute string   `json:"attribute,omitempty"`
+	Severity  string   `json:"severity"`
+	Enabled   string   `json:"enabled"`
+	Codes     []string `json:"codes"`
+}
+
+func Severity(strict bool) string {
+	if strict {
+		return "warning"
 	}
+	return "error"
+}
 
-	return ""
+// TypeCodes are the codes of the findings of a value that is not of a type,
+// besides those of the checks that ListChecks lists on their own.
+var TypeCodes = map[string][]string{
+	"Binary":        {WrongType, InvalidBase64},
+	"Boolean":       {WrongType},
+	"Encoding":      {WrongType, EmptyString, InvalidEncoding},
+	"Integer":       {WrongType, OutOfRange},
+	"Media type":    {WrongType, EmptyString, InvalidMediaType, MalformedMediaTypeParameter},
+	"String":        {WrongType, EmptyString},
+	"Timestamp":     {WrongType, InvalidTimestamp},
+	"URI":           {WrongType, EmptyString, InvalidURI, NotAbsoluteURI, MissingHost},
+	"URI-reference": {WrongType, EmptyString, InvalidURI},
 }
 
-func CheckTimestamp(j map[string]interface{}, v string) string {
-	if t := reflect.TypeOf(j[v]).String(); t != "string" {
-		return "Attribute `" + v + "` is not of type Timestamp (is currently of type " + t + ")\n"
+// OtherChecks are the checks that are neither EventChecks nor BatchChecks: the
+// ones that Verify makes of every attribute and those of the server, the
+// binary mode, streams, schemas and the registry.
+var OtherChecks = []CheckInfo{
+	{"attributes are not null", "", "error", "always", []string{NullValue}},
+	{"`source` is not longer than -max-source-length", "source", "error", "always", []string{TooLong}},
+	{"a `source` URN is valid", "source", "error", "always", []string{InvalidURN}},
+	{"`id` is not longer than -max-id-length", "id", "warning", "strict and -max-id-length", []string{TooLong}},
+	{"`subject` matches -subject-pattern", "subject", "error", "-subject-pattern", []string{PatternMismatch}},
+	{"URI schemes are lowercase", "", "warning", "strict", []string{UppercaseScheme}},
+	{"`time` has at most 9 fractional second digits", "time", "warning", "strict", []string{ExcessPrecision}},
+	{"members are in the canonical order", "", "error", "-canonical-order", []string{OutOfOrder}},
+	{"attribute names contain only lowercase letters and digits", "", "error", "always", []string{BadExtensionName, CaseVariant}},
+	{"extension names are safe as `ce-` headers", "", "warning", "strict", []string{ReservedName}},
+	{"the event matches the envelope schema", "", "error", "-envelope-schema", []string{SchemaViolation, Timeout}},
+	{"`type` is in the registry", "type", "error", "-registry-url", []string{UnregisteredType}},
+	{"data matches the schema registered for its `type`", "data", "error", "-registry-url", []string{SchemaViolation, Timeout}},
+	{"at most -max-findings findings are reported for an event", "", "error", "-max-findings", []string{Truncated}},
+	{"`id` is not reused by a source within -id-window events", "id", "error", "batch and -id-window", []string{DuplicateID}},
+	{"a `POST` with a body has a `Content-Type`", "", "error", "server", []string{MissingContentType}},
+	{"a structured mode `Content-Type` is JSON", "", "error", "server", []string{UnsupportedFormat}},
+	{"there are at most -max-headers `ce-` headers", "", "error", "server and -max-headers", []string{}},
+	{"`ce-` headers name an attribute", "", "error", "binary mode", []string{BadHeader}},
+	{"`ce-` headers do not collide case-insensitively", "", "error", "binary mode", []string{DuplicateAttribute}},
+	{"attributes come from the right part of the request", "", "error", "binary mode", []string{WrongProvenance}},
+	{"`ce-` trailers agree with the headers", "", "error", "binary mode and -trailer", []string{ConflictingAttribute}},
+	{"`ce-` headers agree with the body", "", "error", "-merge", []string{ConflictingAttribute}},
+}
+
+// ListChecks describes every check that can be run, including the ones that
+// are only enabled by -strict, a flag or the loaded rules.
+func ListChecks() []CheckInfo {
+	var checks []CheckInfo
+
+	for _, e := range Attributes {
+		if e.Required {
+			checks = append(checks, CheckInfo{"`" + e.Name + "` is present", e.Name, "error", "always", []string{MissingRequired}})
+		}
+		checks = append(checks, CheckInfo{"`" + e.Name + "` is a valid " + e.Type, e.Name, "error", "always", TypeCodes[e.Type]})
+		if e.Versions != nil {
+			checks = append(checks, CheckInfo{"`" + e.Name + "` is only used with specversion " + strings.Join(e.Versions, ", "), e.Name, "error", "always", []string{WrongVersion}})
+		}
 	}
 
-	var format = regexp.MustCompile(`^([0-9]+)-(0[1-9]|1[012])-(0[1-9]|[12][0-9]|3[01])[Tt]([01][0-9]|2[0-3]):([0-5][0-9]):([0-5][0-9]|60)(\.[0-9]+)?(([Zz])|([\+|\-]([01][0-9]|2[0-3]):[0-5][0-9]))$`)
+	members := make([]string, 0, len(MemberVersions))
+	for k := range MemberVersions {
+		members = append(members, k)
+	}
+	sort.Strings(members)
 
-	if !format.MatchString(j[v].(string)) {
-		return "Attribute `" + v + "` is not a valid Timestamp"
+	for _, k := range members {
+		checks = append(checks, CheckInfo{"`" + k + "` is only used with specversion " + strings.Join(MemberVersions[k], ", "), k, "error", "always", []string{WrongVersion}})
 	}
 
-	return ""
-}
+	extensions := make([]string, 0, len(LoadedRules.Extensions))
+	for k := range LoadedRules.Extensions {
+		extensions = append(extensions, k)
+	}
+	sort.Strings(extensions)
 
-func CheckEncoding(j map[string]interface{}, v string) string {
-	res := CheckString(j, v)
+	for _, k := range extensions {
+		checks = append(checks, CheckInfo{"`" + k + "` is a valid " + LoadedRules.Extensions[k], k, "error", "rules", TypeCodes[LoadedRules.Extensions[k]]})
+	}
 
-	if res == "" {
-		var format = regexp.MustCompile(`(7bit|8bit|binary|quoted-printable|base64)`)
+	for _, r := range LoadedRules.Types {
+		for _, k := range r.Required {
+			checks = append(checks, CheckInfo{"`" + k + "` is present when `type` matches " + strconv.Quote(r.Pattern), k, "error", "rules", []string{MissingRequired}})
+		}
+	}
 
-		if !format.MatchString(j[v].(string)) {
-			return "Attribute `" + v + "` is not a valid encoding type"
+	for _, c := range EventChecks {
+		enabled := "always"
+		if c.Strict {
+			enabled = "strict"
 		}
+		if c.Flag != "" {
+			enabled = c.Flag
+		}
+		checks = append(checks, CheckInfo{c.Name, c.Attribute, Severity(c.Strict), enabled, []string{c.Code}})
 	}
 
-	return res
-}
+	for _, c := range BatchChecks {
+		enabled := "batch"
+		if c.Strict {
+			enabled = "batch and strict"
+		}
+		checks = append(checks, CheckInfo{c.Name, c.Attribute, Severity(c.Strict), enabled, []string{c.Code}})
+	}
 
-func CheckMediaType(j map[string]interface{}, v string) string {
-	res := CheckString(j, v)
+	return append(checks, OtherChecks...)
+}
 
-	if res == "" {
-		var format = regexp.MustCompile(`(application|audio|font|example|image|message|model|multipart|text|video)\/(\S+)`)
+// PerformedChecks is the part of ListChecks that -only leaves enabled.
+func PerformedChecks() []CheckInfo {
+	var checks []CheckInfo
 
-		if !format.MatchString(j[v].(string)) {
-			return "Attribute `" + v + "` is not a valid media type\n"
+	for _, c := range ListChecks() {
+		if Only == "" || c.Attribute == Only {
+			checks = append(checks, c)
 		}
 	}
 
-	return res
+	return checks
 }
 
-func CheckMap(j map[string]interface{}, v string) string {
-	res := CheckVar(j, v, "map[string]interface {}")
-
-	if res == "" {
-		if len(j[v].(map[string]interface{})) == 0 {
-			return "Attribute `" + v + "` must contain at least one entry\n"
+func PrintPerformedChecks() {
+	if Verbose {
+		for _, c := range PerformedChecks() {
+			fmt.Fprintf(os.Stderr, "Checking: %s (%s)\n", c.Name, c.Enabled)
 		}
 	}
+}
 
-	return res
+func HandleListChecks() {
+	checks := ListChecks()
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(checks, "", JSONIndent)
+		fmt.Println(string(bytes))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tATTRIBUTE\tSEVERITY\tENABLED\tCODES")
+	for _, c := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Name, c.Attribute, c.Severity, c.Enabled, strings.Join(c.Codes, ", "))
+	}
+	w.Flush()
 }
 
-func VerifyJSON(j map[string]interface{}) string {
-	reason := ""
+func HasData(j map[string]interface{}) bool {
+	return j["data"] != nil || j["data_base64"] != nil
+}
 
-	for _, e := range Attributes {
-		if e.Required && j[e.Name] == nil {
-			reason += "Attribute `" + e.Name + "` is missing.\n"
-		}
+func CheckContentTypeWithoutData(j map[string]interface{}) *Finding {
+	if _, ok := j["datacontenttype"]; ok && !HasData(j) {
+		return NewFinding(ContentTypeWithoutData, "datacontenttype", "Attribute `datacontenttype` is set but the event has no `data` or `data_base64`")
+	}
+	return nil
+}
 
-		if v, ok := j[e.Name]; ok {
-			if v == nil {
-				reason += "Attribute `" + e.Name + "` cannot be null.\n"
-			} else {
-				reason += e.Check(j, e.Name)
-			}
-		}
+func CheckEncodingWithoutData(j map[string]interface{}) *Finding {
+	if _, ok := j["datacontentencoding"]; ok && j["specversion"] == "0.3" && j["data"] == nil {
+		return NewFinding(EncodingWithoutData, "datacontentencoding", "Attribute `datacontentencoding` is set but the event has no `data` to encode")
 	}
+	return nil
+}
 
-	for k := range j {
-		if len(regexp.MustCompile(`([a-z]|[0-9])+`).FindString(k)) != len(k) {
-			reason += "Attribute `" + k + "` does not contain only lowercase and 0-9 characters.\n"
+func CheckNoData(j map[string]interface{}) *Finding {
+	t, ok := j["datacontenttype"].(string)
+	if !ok || !HasData(j) {
+		return nil
+	}
+
+	if m, _, err := mime.ParseMediaType(t); err == nil {
+		t = m
+	}
+
+	for _, n := range LoadedRules.NoData {
+		if strings.EqualFold(t, n) {
+			return NewFinding(DataNotAllowed, "datacontenttype", "Attribute `datacontenttype` is "+strconv.Quote(t)+", which the rules declare to have no data, but the event has data")
 		}
 	}
 
-	return reason
+	return nil
 }
 
-func HandleFile(file string) {
-	reason := ""
+// IsXML reports whether the media type t is XML, like application/xml or
+// application/atom+xml.
+func IsXML(t string) bool {
+	if m, _, err := mime.ParseMediaType(t); err == nil {
+		t = m
+	}
+	t = strings.ToLower(t)
+	return t == "application/xml" || t == "text/xml" || strings.HasSuffix(t, "+xml")
+}
 
-	if file == "-" {
-		decoder := json.NewDecoder(os.Stdin)
-		decoder.UseNumber()
-		j := make(map[string]interface{})
+func CheckXMLData(j map[string]interface{}) *Finding {
+	t, ok := j["datacontenttype"].(string)
+	if !ValidateXMLData || !ok || !IsXML(t) {
+		return nil
+	}
 
-		err := decoder.Decode(&j)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
+	var data []byte
+	switch v := j["data"].(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return nil
+	}
 
-		reason = VerifyJSON(j)
-	} else {
-		bytes, err := ioutil.ReadFile(file)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root := false
+	depth := 0
+	for {
+		offset := decoder.InputOffset()
+		t, err := decoder.Token()
+		if err == io.EOF && root {
+			return nil
+		} else if err == io.EOF {
+			return NewFinding(InvalidXML, "data", "Attribute `data` is not well-formed XML (there is no root element)")
+		} else if err != nil {
+			return NewFinding(InvalidXML, "data", "Attribute `data` is not well-formed XML ("+err.Error()+", at byte "+strconv.FormatInt(decoder.InputOffset(), 10)+")")
 		}
 
-		var j map[string]interface{}
-		err = json.Unmarshal(bytes, &j)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+		switch t := t.(type) {
+		case xml.StartElement:
+			if depth == 0 && root {
+				return NewFinding(InvalidXML, "data", "Attribute `data` is not well-formed XML (there is a second root element, at byte "+strconv.FormatInt(offset, 10)+")")
+			}
+			root = true
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(t)) > 0 {
+				return NewFinding(InvalidXML, "data", "Attribute `data` is not well-formed XML (there is text outside the root element, at byte "+strconv.FormatInt(offset, 10)+")")
+			}
 		}
-
-		reason = VerifyJSON(j)
 	}
+}
 
-	if reason != "" {
-		fmt.Fprint(os.Stderr, reason)
-		os.Exit(1)
+// CheckSourceSubjectLength reports a source and subject whose lengths in bytes
+// add up to more than -max-source-subject-length, for consumers that key their
+// storage on the two.
+func CheckSourceSubjectLength(j map[string]interface{}) *Finding {
+	source, _ := j["source"].(string)
+	subject, _ := j["subject"].(string)
+	if MaxSourceSubjectLength <= 0 || len(source)+len(subject) <= MaxSourceSubjectLength {
+		return nil
 	}
+
+	return NewFinding(TooLong, "subject", "Attributes `source` and `subject` are too long together ("+strconv.Itoa(len(source))+" + "+strconv.Itoa(len(subject))+" = "+strconv.Itoa(len(source)+len(subject))+" characters, maximum is "+strconv.Itoa(MaxSourceSubjectLength)+")")
 }
 
-func HandleServer(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
+// CheckDataSize measures a string data as is and any other data as JSON.
+func CheckDataSize(j map[string]interface{}) *Finding {
+	if MaxDataSize <= 0 {
+		return nil
+	}
 
-	if r.Method == "POST" {
-		if t := strings.ToLower(r.Header.Get("Content-Type")); t != "" {
-			j := make(map[string]interface{})
-			reason := ""
+	for _, k := range []string{"data", "data_base64"} {
+		if j[k] == nil {
+			continue
+		}
 
-			if strings.HasPrefix(t, "application/cloudevents") {
-				// structured mode
-				body, err := ioutil.ReadAll(r.Body)
-				if err == nil {
-					err := json.Unmarshal(body, &j)
-					if err != nil {
-						w.WriteHeader(http.StatusBadRequest)
-						w.Write([]byte(err.Error()))
-						return
-					}
-				}
+		if size := DataSize(j[k]); size > MaxDataSize {
+			return NewFinding(DataTooLarge, k, "Attribute `"+k+"` is too large ("+strconv.Itoa(size)+" bytes, maximum is "+strconv.Itoa(MaxDataSize)+")")
+		}
+	}
 
-				reason = VerifyJSON(j)
-			} else {
-				// binary mode
-				j["datacontenttype"] = t
+	return nil
+}
 
-				body, err := ioutil.ReadAll(r.Body)
-				if err == nil {
-					j["data"] = string(body)
-				}
+func DataSize(v interface{}) int {
+	if s, ok := v.(string); ok {
+		return len(s)
+	} else if b, ok := v.([]byte); ok {
+		return len(b)
+	} else if b, err := json.Marshal(v); err == nil {
+		return len(b)
+	}
+	return 0
+}
 
-				for h := range r.Header {
-					if strings.HasPrefix(strings.ToLower(h), "ce-") {
-						if n := strings.ToLower(h[3:]); len(n) == 0 {
-							reason += "Bad CloudEvent header.\n"
-						} else {
-							j[n] = r.Header[h][0]
-						}
-					}
-				}
+// CheckSubjectWithData flags large data without a subject, as consumers that
+// route on subject then have to look into the data instead. The inverse, a
+// subject without data, is common for events whose data is retrieved elsewhere.
+func CheckSubjectWithData(j map[string]interface{}) *Finding {
+	if SubjectDataSize <= 0 || j["subject"] != nil {
+		return nil
+	}
 
-				reason += regexp.MustCompile(`(?i)attribute`).ReplaceAllString(VerifyJSON(j), "HTTP header")
-			}
+	for _, k := range []string{"data", "data_base64"} {
+		if j[k] == nil {
+			continue
+		}
 
-			if reason != "" {
-				w.WriteHeader(http.StatusBadRequest)
-			}
-			w.Write([]byte(reason))
-		} else {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte("The header 'Content-Type' must be defined"))
+		if size := DataSize(j[k]); size > SubjectDataSize {
+			return NewFinding(MissingSubject, "subject", "Attribute `subject` is not set although `"+k+"` is large ("+strconv.Itoa(size)+" bytes, more than "+strconv.Itoa(SubjectDataSize)+")")
 		}
-	} else {
-		w.Write([]byte(`<body style="font-family: Segoe UI"><h1>CloudEvents Verify</h1>
+	}
 
-A tool to help verify CloudEvents according to the <a href="https://github.com/cloudevents/spec/blob/master/spec.md">specifications</a>.
+	return nil
+}
 
-<h2>Usage</h2>
+// TimeSentinels are instants a producer that never set the time ends up with.
+var TimeSentinels = []time.Time{time.Time{}, time.Unix(0, 0)}
 
-If no value is returned, the CloudEvent is correct. Otherwise, an error will be returned.
-<br>
-- To see how to send proper requests to this server, see the <a href="https://github.com/cloudevents/spec/blob/master/http-transport-binding.md">HTTP Transport Binding for CloudEvents</a>.
+func CheckTimeSentinel(j map[string]interface{}) *Finding {
+	t, ok := ParsedTime(j)
+	if !ok {
+		return nil
+	}
 
-<div style="position: absolute; top: 0; right: 5px;"><a href="https://github.com/btbd/CEVerify">source</a></div></body>`))
+	for _, s := range TimeSentinels {
+		if t.Equal(s) {
+			return NewFinding(SentinelTime, "time", "Attribute `time` is "+strconv.Quote(j["time"].(string))+", which usually means the time was never set")
+		}
 	}
-}
 
-func main() {
-	file := ""
-	port := 80
-	crt := ""
-	key := ""
+	return nil
+}
 
-	usage := flag.Usage
-	flag.Usage = func() {
-		fmt.Println("CloudEvents specification checker")
-		usage()
+func CheckVar(j map[string]interface{}, v string, t string) *Finding {
+	if c := reflect.TypeOf(j[v]).String(); c != t {
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type "+t+" (is currently of type "+c+")")
 	}
+	return nil
+}
 
-	flag.StringVar(&file, "f", file, "file")
-	flag.IntVar(&port, "p", port, "port")
-	flag.StringVar(&crt, "crt", crt, "certificate for TLS")
-	flag.StringVar(&key, "key", key, "key for TLS")
+func CheckString(j map[string]interface{}, v string) *Finding {
+	res := CheckVar(j, v, "string")
+
+	if res == nil && len(j[v].(string)) == 0 {
+		return NewFinding(EmptyString, v, "Attribute `"+v+"` cannot be an empty string")
+	}
+
+	return res
+}
+
+// CheckSpecVersion also says that the checks that depend on the specversion
+// were skipped when it is not a string, as a number like 1.0 often is.
+func CheckSpecVersion(j map[string]interface{}, v string) *Finding {
+	switch n := j[v].(type) {
+	case float64:
+		s := strconv.FormatFloat(n, 'f', -1, 64)
+		if n == math.Trunc(n) {
+			s = strconv.FormatFloat(n, 'f', 1, 64)
+		}
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type String (is currently the number "+s+", quote it as \""+s+"\"); checks that depend on the specversion were skipped")
+	case json.Number:
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type String (is currently the number "+string(n)+", quote it as \""+string(n)+"\"); checks that depend on the specversion were skipped")
+	case string:
+		return CheckString(j, v)
+	}
+
+	return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type String (is currently of type "+reflect.TypeOf(j[v]).String()+"); checks that depend on the specversion were skipped")
+}
+
+func CheckBase64(j map[string]interface{}, v string) *Finding {
+	if t := reflect.TypeOf(j[v]).String(); t != "string" {
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type Binary (is currently of type "+t+")")
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(j[v].(string)); err != nil {
+		return NewFinding(InvalidBase64, v, "Attribute `"+v+"` is not valid base64 ("+err.Error()+")")
+	}
+
+	return nil
+}
+
+var AttributeNamePattern = regexp.MustCompile(`([a-z]|[0-9])+`)
+
+var IntegerPattern = regexp.MustCompile(`^[-+]?[0-9]+$`)
+
+// CheckBoolean rejects every string, since TypedHeaderValues converts the
+// "true" and "false" of binary mode and JSON has booleans of its own.
+func CheckBoolean(j map[string]interface{}, v string) *Finding {
+	if b, ok := j[v].(string); ok {
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type Boolean (is currently "+strconv.Quote(b)+")")
+	}
+
+	return CheckVar(j, v, "bool")
+}
+
+// CheckInteger checks a JSON number, into which TypedHeaderValues converts the
+// strings of binary mode. The spec's Integer is a signed 32-bit integer.
+func CheckInteger(j map[string]interface{}, v string) *Finding {
+	var n float64
+
+	switch value := j[v].(type) {
+	case float64:
+		n = value
+	case json.Number:
+		// the JSON text of an Integer has neither a fraction nor an exponent
+		f, err := value.Float64()
+		if err != nil || !IntegerPattern.MatchString(string(value)) {
+			return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type Integer (is currently "+string(value)+")")
+		}
+		n = f
+	case string:
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type Integer (is currently "+strconv.Quote(value)+")")
+	default:
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type Integer (is currently of type "+reflect.TypeOf(j[v]).String()+")")
+	}
+
+	if n != math.Trunc(n) {
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type Integer (is currently "+fmt.Sprint(j[v])+")")
+	}
+
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return NewFinding(OutOfRange, v, "Attribute `"+v+"` is out of the range of Integer (is currently "+fmt.Sprint(j[v])+", which does not fit in 32 bits)")
+	}
+
+	return nil
+}
+
+// CheckSuspiciousStrings reports the first undeclared extension whose string
+// value looks like it was meant to be a boolean or an integer.
+func CheckSuspiciousStrings(j map[string]interface{}) *Finding {
+	keys := make([]string, 0, len(j))
+	for k := range j {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if _, ok := LoadedRules.Extensions[k]; ok || IsAttribute(k) || k == "data" || k == "data_base64" || (Only != "" && k != Only) {
+			continue
+		}
+
+		if s, ok := j[k].(string); ok && (s == "true" || s == "false" || IntegerPattern.MatchString(s)) {
+			return NewFinding(SuspiciousString, k, "Attribute `"+k+"` is the string "+strconv.Quote(s)+", which looks like it should not be quoted")
+		}
+	}
+
+	return nil
+}
+
+// CheckASCII reports the first attribute whose value has a character that
+// needs percent-encoding as a header in binary mode, where transcoders often
+// get it wrong.
+func CheckASCII(j map[string]interface{}) *Finding {
+	keys := make([]string, 0, len(j))
+	for k := range j {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s, ok := j[k].(string)
+		if !ok || k == "data" || k == "data_base64" || (Only != "" && k != Only) {
+			continue
+		}
+
+		for _, r := range s {
+			if r > unicode.MaxASCII {
+				return NewFinding(NonASCII, k, "Attribute `"+k+"` contains the non-ASCII character "+strconv.QuoteRune(r)+" ("+fmt.Sprintf("%U", r)+"), which has to be percent-encoded in an HTTP header")
+			}
+		}
+	}
+
+	return nil
+}
+
+// URICharacters are the characters of a URI besides percent-encoded octets.
+const URICharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~:/?#[]@!$&'()*+,;="
+
+// IsPercentEncoded reports whether the '%' at i of uri starts an octet of two
+// hex digits.
+func IsPercentEncoded(uri string, i int) bool {
+	return i+2 < len(uri) && strings.IndexByte(HexDigits, uri[i+1]) >= 0 && strings.IndexByte(HexDigits, uri[i+2]) >= 0
+}
+
+const HexDigits = "0123456789ABCDEFabcdef"
+
+func CheckURIReference(j map[string]interface{}, v string) *Finding {
+	if t := reflect.TypeOf(j[v]).String(); t != "string" {
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type URI-reference (is currently of type "+t+")")
+	}
+
+	if len(j[v].(string)) == 0 {
+		return NewFinding(EmptyString, v, "Attribute `"+v+"` cannot be empty")
+	}
+
+	uri := j[v].(string)
+
+	for i := 0; i < len(uri); i++ {
+		if uri[i] == '%' {
+			if !IsPercentEncoded(uri, i) {
+				end := i + 3
+				if end > len(uri) {
+					end = len(uri)
+				}
+				return NewFinding(InvalidURI, v, "Attribute `"+v+"` is not a valid URI (invalid percent-encoding "+strconv.Quote(uri[i:end])+" at character "+strconv.Itoa(i)+")")
+			}
+			i += 2
+		} else if !strings.Contains(URICharacters, string(uri[i])) {
+			return NewFinding(InvalidURI, v, "Attribute `"+v+"` is not a valid URI (contains illegal character '"+string(uri[i])+"')")
+		}
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return NewFinding(InvalidURI, v, "Attribute `"+v+"` is not a valid URI ("+err.(*url.Error).Err.Error()+")")
+	}
+
+	if Strict && NormalizeScheme(uri, u) != uri {
+		return NewFinding(UppercaseScheme, v, "Attribute `"+v+"` has uppercase letters in its scheme (normalized form is "+strconv.Quote(NormalizeScheme(uri, u))+")")
+	}
+
+	return nil
+}
+
+// NormalizeScheme lowercases the scheme of uri, which url.Parse has already
+// done for u.
+func NormalizeScheme(uri string, u *url.URL) string {
+	if u.Scheme == "" {
+		return uri
+	}
+	return u.Scheme + uri[len(u.Scheme):]
+}
+
+// NetworkSchemes are the URI schemes that name a host, unlike e.g. urn or
+// mailto.
+var NetworkSchemes = []string{"http", "https", "ws", "wss", "ftp"}
+
+func CheckAbsoluteURI(j map[string]interface{}, v string) *Finding {
+	if t := reflect.TypeOf(j[v]).String(); t != "string" {
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type URI (is currently of type "+t+")")
+	}
+
+	res := CheckURIReference(j, v)
+
+	// an uppercase scheme is only a warning, so it gives way to the errors
+	if res == nil || res.Code == UppercaseScheme {
+		if u, _ := url.Parse(j[v].(string)); !u.IsAbs() {
+			return NewFinding(NotAbsoluteURI, v, "Attribute `"+v+"` is not an absolute URI (missing scheme)")
+		} else if StringInSlice(u.Scheme, NetworkSchemes) && u.Hostname() == "" {
+			return NewFinding(MissingHost, v, "Attribute `"+v+"` is not a valid URI (scheme "+u.Scheme+" requires a host)")
+		}
+	}
+
+	return res
+}
+
+// CheckID suggests quoting a numeric id, which is the most common mistake.
+func CheckID(j map[string]interface{}, v string) *Finding {
+	var n string
+	switch value := j[v].(type) {
+	case float64:
+		n = strconv.FormatFloat(value, 'f', -1, 64)
+	case json.Number:
+		n = string(value)
+	}
+	if n != "" {
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type String (is currently the number "+n+", quote it as \""+n+"\")")
+	}
+
+	res := CheckString(j, v)
+
+	if res == nil && Strict && MaxIDLength > 0 && len(j[v].(string)) > MaxIDLength {
+		return NewFinding(TooLong, v, "Attribute `"+v+"` is too long ("+strconv.Itoa(len(j[v].(string)))+" characters, maximum is "+strconv.Itoa(MaxIDLength)+")")
+	}
+
+	return res
+}
+
+func CheckSource(j map[string]interface{}, v string) *Finding {
+	res := CheckURIReference(j, v)
+
+	if res == nil && len(j[v].(string)) >= 4 && strings.EqualFold(j[v].(string)[:4], "urn:") {
+		res = CheckURN(j, v)
+	}
+
+	if res == nil && MaxSourceLength > 0 && len(j[v].(string)) > MaxSourceLength {
+		return NewFinding(TooLong, v, "Attribute `"+v+"` is too long ("+strconv.Itoa(len(j[v].(string)))+" characters, maximum is "+strconv.Itoa(MaxSourceLength)+")")
+	}
+
+	return res
+}
+
+var URNNamespace = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,30}[A-Za-z0-9]$`)
+var URNString = regexp.MustCompile(`^([A-Za-z0-9\-._~!$&'()*+,;=:@]|%[0-9A-Fa-f]{2})([A-Za-z0-9\-._~!$&'()*+,;=:@/]|%[0-9A-Fa-f]{2})*$`)
+var URNComponents = regexp.MustCompile(`^(\?\+[^?#]+)?(\?=[^#]+)?(#.*)?$`)
+
+// CheckURN checks the syntax of RFC 8141, which is stricter than that of other
+// URIs: urn:<NID>:<NSS> with optional ?+, ?= and # components.
+func CheckURN(j map[string]interface{}, v string) *Finding {
+	urn := j[v].(string)[4:]
+
+	if i := strings.IndexAny(urn, "?#"); i >= 0 {
+		rest := urn[i:]
+		urn = urn[:i]
+
+		if !URNComponents.MatchString(rest) {
+			return NewFinding(InvalidURN, v, "Attribute `"+v+"` is not a valid URN (components after the NSS must be ?+, ?= and # in that order)")
+		}
+	}
+
+	parts := strings.SplitN(urn, ":", 2)
+	if !URNNamespace.MatchString(parts[0]) {
+		return NewFinding(InvalidURN, v, "Attribute `"+v+"` is not a valid URN (namespace identifier "+strconv.Quote(parts[0])+" is not 2 to 32 letters, digits or inner hyphens)")
+	}
+
+	if len(parts) < 2 || !URNString.MatchString(parts[1]) {
+		return NewFinding(InvalidURN, v, "Attribute `"+v+"` is not a valid URN (missing or invalid namespace specific string, in which every % is followed by two hex digits)")
+	}
+
+	return nil
+}
+
+func CheckSubject(j map[string]interface{}, v string) *Finding {
+	res := CheckString(j, v)
+
+	if res == nil && SubjectPattern != nil && !SubjectPattern.MatchString(j[v].(string)) {
+		return NewFinding(PatternMismatch, v, "Attribute `"+v+"` does not match the subject pattern (is currently "+strconv.Quote(j[v].(string))+")")
+	}
+
+	return res
+}
+
+var TimestampPattern = regexp.MustCompile(`^([0-9]+)-(0[1-9]|1[012])-(0[1-9]|[12][0-9]|3[01])[Tt]([01][0-9]|2[0-3]):([0-5][0-9]):([0-5][0-9]|60)(\.[0-9]+)?(([Zz])|([\+|\-]([01][0-9]|2[0-3]):[0-5][0-9]))$`)
+
+func CheckTimestamp(j map[string]interface{}, v string) *Finding {
+	if t := reflect.TypeOf(j[v]).String(); t != "string" {
+		return NewFinding(WrongType, v, "Attribute `"+v+"` is not of type Timestamp (is currently of type "+t+")")
+	}
+
+	m := TimestampPattern.FindStringSubmatch(j[v].(string))
+	if m == nil {
+		return NewFinding(InvalidTimestamp, v, "Attribute `"+v+"` is not a valid Timestamp")
+	}
+
+	if digits := len(m[7]) - 1; Strict && digits > 9 {
+		return NewFinding(ExcessPrecision, v, "Attribute `"+v+"` has "+strconv.Itoa(digits)+" fractional second digits (more than nanosecond precision)")
+	}
+
+	return nil
+}
+
+// ParsedTime returns the instant of the event's time, for comparing or sorting
+// events; it is false when time is absent or not a valid Timestamp.
+func ParsedTime(j map[string]interface{}) (time.Time, bool) {
+	if j["time"] == nil || CheckTimestamp(j, "time") != nil {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, j["time"].(string))
+	return t, err == nil
+}
+
+func CheckEncoding(j map[string]interface{}, v string) *Finding {
+	res := CheckString(j, v)
+
+	if res == nil {
+		var format = regexp.MustCompile(`(7bit|8bit|binary|quoted-printable|base64)`)
+
+		if !format.MatchString(j[v].(string)) {
+			return NewFinding(InvalidEncoding, v, "Attribute `"+v+"` is not a valid encoding type")
+		}
+	}
+
+	return res
+}
+
+var MediaTypes = []string{"application", "audio", "font", "example", "image", "message", "model", "multipart", "text", "video"}
+
+func CheckMediaType(j map[string]interface{}, v string) *Finding {
+	res := CheckString(j, v)
+
+	if res == nil {
+		// types and subtypes are case-insensitive, and come back lowercased
+		t, _, err := mime.ParseMediaType(j[v].(string))
+		if err == mime.ErrInvalidMediaParameter {
+			return NewFinding(MalformedMediaTypeParameter, v, "Attribute `"+v+"` has a malformed parameter")
+		} else if err != nil {
+			return NewFinding(InvalidMediaType, v, "Attribute `"+v+"` is not a valid media type ("+err.Error()+")")
+		}
+
+		parts := strings.Split(t, "/")
+		if len(parts) != 2 || !StringInSlice(parts[0], MediaTypes) {
+			return NewFinding(InvalidMediaType, v, "Attribute `"+v+"` is not a valid media type")
+		}
+	}
+
+	return res
+}
+
+func StringInSlice(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func CheckMap(j map[string]interface{}, v string) *Finding {
+	res := CheckVar(j, v, "map[string]interface {}")
+
+	if res == nil {
+		if len(j[v].(map[string]interface{})) == 0 {
+			return NewFinding(EmptyMap, v, "Attribute `"+v+"` must contain at least one entry")
+		}
+	}
+
+	return res
+}
+
+func IsAttribute(name string) bool {
+	for _, e := range Attributes {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func LoadRules(file string) (Rules, error) {
+	var rules Rules
+
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return rules, err
+	}
+
+	if err := json.Unmarshal(bytes, &rules); err != nil {
+		return rules, err
+	}
+
+	for k, t := range rules.Extensions {
+		if _, ok := ExtensionTypes[t]; !ok {
+			return rules, fmt.Errorf("extension `%s` has unknown type %q", k, t)
+		}
+	}
+
+	for i, r := range rules.Types {
+		if rules.Types[i].pattern, err = regexp.Compile(`^(?:` + r.Pattern + `)$`); err != nil {
+			return rules, fmt.Errorf("type pattern %q: %s", r.Pattern, err)
+		}
+	}
+
+	return rules, nil
+}
+
+//go:embed schemas/cloudevents.json
+var BundledSchema []byte
+
+// SchemaDrafts are the drafts of JSON Schema that SchemaErrors can follow,
+// SchemaDraft being the one of -schema-draft. The schemas of CloudEvents are
+// draft 7.
+var SchemaDrafts = []string{"draft7", "2020-12"}
+var SchemaDraft = "draft7"
+
+// EnvelopeSchema is the JSON Schema that whole events are validated against
+// on top of the other checks, nil for none.
+var EnvelopeSchema interface{}
+
+// LoadSchema loads a JSON Schema from file or, for "bundled", the bundled
+// schema of CloudEvents 1.0.
+func LoadSchema(file string) (interface{}, error) {
+	body := BundledSchema
+
+	if file != "bundled" {
+		var err error
+		if body, err = ioutil.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	var schema interface{}
+	if err := json.Unmarshal(body, &schema); err != nil {
+		return nil, err
+	}
+
+	if err := CheckSchema(schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// SchemaKeywords are the keywords that SchemaErrors validates besides those
+// holding schemas, and the annotations that it may ignore because they do not
+// constrain the value.
+var SchemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "required": true, "format": true,
+	"pattern": true, "minLength": true, "maxLength": true, "minimum": true,
+	"maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+	"minItems": true, "maxItems": true, "uniqueItems": true,
+
+	"$schema": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "readOnly": true, "writeOnly": true,
+	"deprecated": true, "contentEncoding": true, "contentMediaType": true,
+}
+
+// CheckSchema rejects a schema that SchemaErrors cannot follow faithfully:
+// one with a keyword it does not implement, a $ref that is not local or does
+// not resolve, or a $ref that leads back to itself without descending into
+// the value, which would never end.
+func CheckSchema(root interface{}) error {
+	var nodes []map[string]interface{}
+
+	var walk func(schema interface{}, pointer string) error
+	walk = func(schema interface{}, pointer string) error {
+		if _, ok := schema.(bool); ok {
+			return nil
+		}
+		s, ok := schema.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not a schema (an object or a boolean)", strconv.Quote("#"+pointer))
+		}
+		nodes = append(nodes, s)
+
+		keys := make([]string, 0, len(s))
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p := pointer + "/" + EscapePointerToken(k)
+			_, isList := s[k].([]interface{})
+
+			switch {
+			case k == "$ref":
+				ref, _ := s[k].(string)
+				if !strings.HasPrefix(ref, "#") {
+					return fmt.Errorf("%s has the unsupported $ref %s (only local ones are)", strconv.Quote("#"+pointer), strconv.Quote(ref))
+				}
+				if _, err := ResolvePointer(root, ref[1:]); err != nil {
+					return fmt.Errorf("%s has the $ref %s: %s", strconv.Quote("#"+pointer), strconv.Quote(ref), err)
+				}
+			case k == "$id" && pointer == "":
+			case k == "definitions" || k == "$defs" || k == "properties":
+				m, ok := s[k].(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%s is not an object of schemas", strconv.Quote("#"+p))
+				}
+				names := make([]string, 0, len(m))
+				for name := range m {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					if err := walk(m[name], p+"/"+EscapePointerToken(name)); err != nil {
+						return err
+					}
+				}
+			case k == "allOf" || k == "anyOf" || k == "oneOf" || (k == "prefixItems" && SchemaDraft == "2020-12") ||
+				(k == "items" && SchemaDraft != "2020-12" && isList):
+				list, ok := s[k].([]interface{})
+				if !ok {
+					return fmt.Errorf("%s is not an array of schemas", strconv.Quote("#"+p))
+				}
+				for i, e := range list {
+					if err := walk(e, p+"/"+strconv.Itoa(i)); err != nil {
+						return err
+					}
+				}
+			case k == "items" || k == "additionalProperties" || k == "not" || (k == "additionalItems" && SchemaDraft != "2020-12"):
+				if err := walk(s[k], p); err != nil {
+					return err
+				}
+			case !SchemaKeywords[k]:
+				return fmt.Errorf("%s has the unsupported keyword %s", strconv.Quote("#"+pointer), strconv.Quote(k))
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root, ""); err != nil {
+		return err
+	}
+
+	// $ref, allOf, anyOf, oneOf and not apply to the same value, so following
+	// them back to a schema that is being followed would never end
+	const following, followed = 1, 2
+	state := map[uintptr]int{}
+
+	var follow func(schema interface{}, ref string) error
+	follow = func(schema interface{}, ref string) error {
+		s, ok := schema.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		id := reflect.ValueOf(s).Pointer()
+		if state[id] == following {
+			return fmt.Errorf("the $ref %s leads back to itself without descending into the value", strconv.Quote(ref))
+		} else if state[id] == followed {
+			return nil
+		}
+		state[id] = following
+
+		if r, ok := s["$ref"].(string); ok {
+			target, _ := ResolvePointer(root, r[1:])
+			if err := follow(target, r); err != nil {
+				return err
+			}
+		}
+		for _, k := range []string{"allOf", "anyOf", "oneOf"} {
+			list, _ := s[k].([]interface{})
+			for _, e := range list {
+				if err := follow(e, ref); err != nil {
+					return err
+				}
+			}
+		}
+		if not, ok := s["not"]; ok {
+			if err := follow(not, ref); err != nil {
+				return err
+			}
+		}
+
+		state[id] = followed
+		return nil
+	}
+
+	for _, s := range nodes {
+		if err := follow(s, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SchemaError is a violation of a JSON Schema by the value at Pointer, which
+// is in the property Attribute of the root value, if any.
+type SchemaError struct {
+	Pointer   string
+	Message   string
+	Attribute string
+}
+
+// SchemaErrors validates v against the subset of JSON Schema draft 7 that the
+// CloudEvents schemas use: local $ref, type, enum, const, required,
+// properties, additionalProperties, items, allOf, anyOf, oneOf, not, format,
+// pattern, minLength, maxLength, minimum and maximum, along with
+// exclusiveMinimum, exclusiveMaximum, minItems, maxItems and uniqueItems. The
+// schema must have passed CheckSchema.
+func SchemaErrors(ctx context.Context, root interface{}, schema interface{}, v interface{}, pointer string) []SchemaError {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if b, ok := schema.(bool); ok {
+		if !b {
+			return []SchemaError{{pointer, "no value is allowed", ""}}
+		}
+		return nil
+	}
+
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		if !strings.HasPrefix(ref, "#") {
+			return []SchemaError{{pointer, "unsupported $ref " + strconv.Quote(ref), ""}}
+		}
+
+		target, err := ResolvePointer(root, ref[1:])
+		if err != nil {
+			return []SchemaError{{pointer, "$ref " + strconv.Quote(ref) + ": " + err.Error(), ""}}
+		}
+		// draft 7 ignores the siblings of $ref, 2020-12 applies them as well
+		if SchemaDraft != "2020-12" {
+			return SchemaErrors(ctx, root, target, v, pointer)
+		}
+	}
+
+	var errs []SchemaError
+	fail := func(format string, a ...interface{}) {
+		errs = append(errs, SchemaError{pointer, fmt.Sprintf(format, a...), ""})
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		target, _ := ResolvePointer(root, ref[1:])
+		errs = append(errs, SchemaErrors(ctx, root, target, v, pointer)...)
+	}
+
+	if t, ok := s["type"]; ok {
+		types, _ := t.([]interface{})
+		if name, ok := t.(string); ok {
+			types = []interface{}{name}
+		}
+
+		matched := false
+		for _, name := range types {
+			if name, ok := name.(string); ok && SchemaType(v, name) {
+				matched = true
+			}
+		}
+		if !matched {
+			fail("is not of type %s", SchemaTypeName(v))
+			return errs
+		}
+	}
+
+	if e, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, c := range e {
+			if SchemaEqual(c, v) {
+				found = true
+			}
+		}
+		if !found {
+			fail("is not one of the allowed values")
+		}
+	}
+
+	if c, ok := s["const"]; ok && !SchemaEqual(c, v) {
+		b, _ := json.Marshal(c)
+		fail("is not %s", b)
+	}
+
+	for _, k := range []string{"allOf", "anyOf", "oneOf"} {
+		list, ok := s[k].([]interface{})
+		if !ok {
+			continue
+		}
+
+		n := 0
+		var sub []SchemaError
+		for _, e := range list {
+			// the other schemas cannot change whether anyOf or oneOf matches
+			if (k == "anyOf" && n == 1) || (k == "oneOf" && n == 2) {
+				break
+			}
+			if r := SchemaErrors(ctx, root, e, v, pointer); len(r) == 0 {
+				n++
+			} else {
+				sub = append(sub, r...)
+			}
+		}
+
+		if k == "allOf" {
+			errs = append(errs, sub...)
+		} else if k == "anyOf" && n == 0 {
+			fail("matches none of anyOf")
+		} else if k == "oneOf" && n == 0 {
+			fail("matches none of oneOf")
+		} else if k == "oneOf" && n > 1 {
+			fail("matches more than one of oneOf")
+		}
+	}
+
+	if not, ok := s["not"]; ok && len(SchemaErrors(ctx, root, not, v, pointer)) == 0 {
+		fail("matches not")
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if required, ok := s["required"].([]interface{}); ok {
+			for _, k := range required {
+				if k, ok := k.(string); ok {
+					if _, ok := v[k]; !ok {
+						fail("is missing the required property %s", strconv.Quote(k))
+						if pointer == "" {
+							errs[len(errs)-1].Attribute = k
+						}
+					}
+				}
+			}
+		}
+
+		properties, _ := s["properties"].(map[string]interface{})
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p := pointer + "/" + EscapePointerToken(k)
+			var sub []SchemaError
+			if schema, ok := properties[k]; ok {
+				sub = SchemaErrors(ctx, root, schema, v[k], p)
+			} else if additional, ok := s["additionalProperties"]; ok {
+				sub = SchemaErrors(ctx, root, additional, v[k], p)
+			}
+			if pointer == "" {
+				for i := range sub {
+					sub[i].Attribute = k
+				}
+			}
+			errs = append(errs, sub...)
+		}
+	case []interface{}:
+		// a list of schemas for the first items is "items" in draft 7 and
+		// "prefixItems" in 2020-12, followed by "additionalItems" or "items"
+		var tuple []interface{}
+		var rest interface{}
+		if SchemaDraft == "2020-12" {
+			tuple, _ = s["prefixItems"].([]interface{})
+			rest = s["items"]
+		} else if t, ok := s["items"].([]interface{}); ok {
+			tuple, rest = t, s["additionalItems"]
+		} else {
+			rest = s["items"]
+		}
+
+		n := float64(len(v))
+		if min, ok := SchemaNumber(s["minItems"]); ok && n < min {
+			fail("has fewer than %v items", min)
+		}
+		if max, ok := SchemaNumber(s["maxItems"]); ok && n > max {
+			fail("has more than %v items", max)
+		}
+		if unique, _ := s["uniqueItems"].(bool); unique {
+		unique:
+			for i := range v {
+				for k := 0; k < i; k++ {
+					if SchemaEqual(v[k], v[i]) {
+						fail("has the items %d and %d equal", k, i)
+						break unique
+					}
+				}
+			}
+		}
+
+		for i, e := range v {
+			if i < len(tuple) {
+				errs = append(errs, SchemaErrors(ctx, root, tuple[i], e, pointer+"/"+strconv.Itoa(i))...)
+			} else if rest != nil {
+				errs = append(errs, SchemaErrors(ctx, root, rest, e, pointer+"/"+strconv.Itoa(i))...)
+			}
+		}
+	case string:
+		n := float64(len([]rune(v)))
+		if min, ok := SchemaNumber(s["minLength"]); ok && n < min {
+			fail("is shorter than %v characters", min)
+		}
+		if max, ok := SchemaNumber(s["maxLength"]); ok && n > max {
+			fail("is longer than %v characters", max)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err != nil {
+				fail("has an invalid pattern (%s)", err)
+			} else if !re.MatchString(v) {
+				fail("does not match the pattern %s", strconv.Quote(pattern))
+			}
+		}
+		if format, ok := s["format"].(string); ok {
+			j := map[string]interface{}{"value": v}
+			var f *Finding
+			switch format {
+			case "date-time":
+				f = CheckTimestamp(j, "value")
+			case "uri":
+				f = CheckAbsoluteURI(j, "value")
+			case "uri-reference":
+				f = CheckURIReference(j, "value")
+			}
+			if f != nil {
+				fail("is not a valid %s", format)
+			}
+		}
+	default:
+		if n, ok := SchemaNumber(v); ok {
+			if min, ok := SchemaNumber(s["minimum"]); ok && n < min {
+				fail("is less than %v", min)
+			}
+			if max, ok := SchemaNumber(s["maximum"]); ok && n > max {
+				fail("is greater than %v", max)
+			}
+			if min, ok := SchemaNumber(s["exclusiveMinimum"]); ok && n <= min {
+				fail("is not greater than %v", min)
+			}
+			if max, ok := SchemaNumber(s["exclusiveMaximum"]); ok && n >= max {
+				fail("is not less than %v", max)
+			}
+		}
+	}
+
+	return errs
+}
+
+func SchemaNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func SchemaType(v interface{}, name string) bool {
+	switch name {
+	case "integer":
+		n, ok := SchemaNumber(v)
+		return ok && n == float64(int64(n))
+	case "number":
+		_, ok := SchemaNumber(v)
+		return ok
+	}
+	return SchemaTypeName(v) == name
+}
+
+func SchemaTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	if _, ok := SchemaNumber(v); ok {
+		return "number"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+func SchemaEqual(a interface{}, b interface{}) bool {
+	if x, ok := SchemaNumber(a); ok {
+		y, ok := SchemaNumber(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// StructuredEvent is j as the JSON format would carry it, with binary data
+// moved to data_base64.
+func StructuredEvent(j map[string]interface{}) map[string]interface{} {
+	b, ok := j["data"].([]byte)
+	if !ok {
+		return j
+	}
+
+	e := make(map[string]interface{}, len(j))
+	for k, v := range j {
+		if k != "data" {
+			e[k] = v
+		}
+	}
+	e["data_base64"] = base64.StdEncoding.EncodeToString(b)
+
+	return e
+}
+
+// Registry describes the event types that an organization allows, as served
+// at -registry-url.
+type Registry struct {
+	Types map[string]RegisteredType `json:"types"`
+}
+
+type RegisteredType struct {
+	// Schema is the JSON Schema of the data, nil for any data.
+	Schema interface{} `json:"schema"`
+}
+
+// EventRegistry is fetched once per run, nil without -registry-url.
+var EventRegistry *Registry
+
+func LoadRegistry(addr string) (*Registry, error) {
+	body, err := FetchURL(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var registry Registry
+	if err := json.Unmarshal(body, &registry); err != nil {
+		return nil, err
+	} else if registry.Types == nil {
+		return nil, errors.New("a registry must have an object of types")
+	}
+
+	for t, registered := range registry.Types {
+		if registered.Schema == nil {
+			continue
+		}
+		if err := CheckSchema(registered.Schema); err != nil {
+			return nil, fmt.Errorf("schema of %s: %s", strconv.Quote(t), err)
+		}
+	}
+
+	return &registry, nil
+}
+
+// CheckRegistry reports an event whose type is not in EventRegistry or whose
+// data does not match the schema registered for its type.
+func CheckRegistry(ctx context.Context, j map[string]interface{}) []Finding {
+	t, ok := j["type"].(string)
+	if EventRegistry == nil || !ok || (Only != "" && Only != "type" && Only != "data") {
+		return nil
+	}
+
+	registered, ok := EventRegistry.Types[t]
+	if !ok {
+		if Only == "data" {
+			return nil
+		}
+		return []Finding{*NewFinding(UnregisteredType, "type", "Attribute `type` is "+strconv.Quote(t)+", which is not in the registry")}
+	}
+
+	data, ok := j["data"]
+	if registered.Schema == nil || !ok || Only == "type" {
+		return nil
+	}
+	if b, ok := data.([]byte); ok {
+		// binary mode, where only JSON data can match a schema
+		if err := json.Unmarshal(b, &data); err != nil {
+			return []Finding{*NewFinding(SchemaViolation, "data", "Attribute `data` does not match the registered schema of "+strconv.Quote(t)+" (is not JSON)")}
+		}
+	}
+
+	var findings []Finding
+	for _, e := range SchemaErrors(ctx, registered.Schema, registered.Schema, data, "") {
+		findings = append(findings, *NewFinding(SchemaViolation, "data", "Attribute `data` does not match the registered schema of "+strconv.Quote(t)+" ("+strings.TrimSpace(e.Pointer+" "+e.Message)+")"))
+	}
+	if ctx.Err() != nil {
+		return []Finding{*NewFinding(Timeout, "", "Event could not be verified against the registered schema within -context-timeout ("+ctx.Err().Error()+")")}
+	}
+
+	return findings
+}
+
+// CheckEnvelope validates the whole event against EnvelopeSchema, reporting
+// each error for the attribute it is in, or only that ctx is done if the
+// validation could not finish.
+func CheckEnvelope(ctx context.Context, j map[string]interface{}) []Finding {
+	if EnvelopeSchema == nil {
+		return nil
+	}
+
+	errs := SchemaErrors(ctx, EnvelopeSchema, EnvelopeSchema, StructuredEvent(j), "")
+	if ctx.Err() != nil {
+		return []Finding{*NewFinding(Timeout, "", "Event could not be verified against the envelope schema within -context-timeout ("+ctx.Err().Error()+")")}
+	}
+
+	var findings []Finding
+
+	for _, e := range errs {
+		attribute := e.Attribute
+		if Only != "" && attribute != Only {
+			continue
+		}
+
+		detail := strings.TrimSpace(e.Pointer + " " + e.Message)
+		if attribute != "" {
+			findings = append(findings, *NewFinding(SchemaViolation, attribute, "Attribute `"+attribute+"` does not match the envelope schema ("+detail+")"))
+		} else {
+			findings = append(findings, *NewFinding(SchemaViolation, "", "Event does not match the envelope schema ("+detail+")"))
+		}
+	}
+
+	return findings
+}
+
+// Verify verifies one event within -context-timeout.
+func Verify(j map[string]interface{}) []Finding {
+	return VerifyOrdered(context.Background(), j, nil)
+}
+
+// VerifyOrdered verifies one event within -context-timeout of ctx, and for a
+// JSON event whose members had the given order, -canonical-order.
+func VerifyOrdered(ctx context.Context, j map[string]interface{}, order []string) []Finding {
+	if EventTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, EventTimeout)
+		defer cancel()
+	}
+
+	findings := VerifyContext(ctx, j)
+	if f := CheckOrder(order); f != nil {
+		findings = append(findings, *f)
+	}
+	return findings
+}
+
+// VerifyContext verifies one event, giving up on the checks that may take long
+// once ctx is done.
+func VerifyContext(ctx context.Context, j map[string]interface{}) []Finding {
+	var findings []Finding
+
+	add := func(f *Finding) {
+		if f != nil {
+			findings = append(findings, *f)
+		}
+	}
+
+	for _, e := range Attributes {
+		if Only != "" && e.Name != Only {
+			continue
+		}
+
+		if e.Required && j[e.Name] == nil {
+			add(NewFinding(MissingRequired, e.Name, "Attribute `"+e.Name+"` is missing."))
+		}
+
+		if v, ok := j[e.Name]; ok {
+			if f := CheckVersion(j, e.Name, e.Versions); f != nil {
+				add(f)
+			} else if v == nil {
+				add(NewFinding(NullValue, e.Name, "Attribute `"+e.Name+"` cannot be null."))
+			} else {
+				add(e.Check(j, e.Name))
+			}
+		}
+	}
+
+	members := make([]string, 0, len(MemberVersions))
+	for k := range MemberVersions {
+		members = append(members, k)
+	}
+	sort.Strings(members)
+
+	for _, k := range members {
+		if _, ok := j[k]; ok && (Only == "" || k == Only) {
+			add(CheckVersion(j, k, MemberVersions[k]))
+		}
+	}
+
+	extensions := make([]string, 0, len(LoadedRules.Extensions))
+	for k := range LoadedRules.Extensions {
+		extensions = append(extensions, k)
+	}
+	sort.Strings(extensions)
+
+	for _, k := range extensions {
+		if v, ok := j[k]; ok && !IsAttribute(k) && (Only == "" || k == Only) {
+			if v == nil {
+				add(NewFinding(NullValue, k, "Attribute `"+k+"` cannot be null."))
+			} else {
+				add(ExtensionTypes[LoadedRules.Extensions[k]](j, k))
+			}
+		}
+	}
+
+	if t, ok := j["type"].(string); ok {
+		for _, r := range LoadedRules.Types {
+			if r.pattern == nil || !r.pattern.MatchString(t) {
+				continue
+			}
+
+			for _, k := range r.Required {
+				if j[k] == nil && (Only == "" || k == Only) {
+					add(NewFinding(MissingRequired, k, "Attribute `"+k+"` is missing (required for type "+strconv.Quote(t)+" by pattern "+strconv.Quote(r.Pattern)+")."))
+				}
+			}
+		}
+	}
+
+	for _, c := range EventChecks {
+		// checks without an attribute honor -only themselves
+		if (!c.Strict || Strict) && (Only == "" || c.Attribute == Only || c.Attribute == "") {
+			add(c.Check(j))
+		}
+	}
+
+	for k := range j {
+		if k == "data_base64" || (Only != "" && k != Only) {
+			// the JSON format's member for binary data, not an attribute
+			continue
+		}
+
+		if len(AttributeNamePattern.FindString(k)) != len(k) {
+			l := strings.ToLower(k)
+			if _, ok := j[l]; l != k && (ok || IsAttribute(l)) {
+				add(NewFinding(CaseVariant, k, "Attribute `"+k+"` does not contain only lowercase and 0-9 characters (it only differs from `"+l+"` in case, use `"+l+"`)."))
+			} else {
+				add(NewFinding(BadExtensionName, k, "Attribute `"+k+"` does not contain only lowercase and 0-9 characters."))
+			}
+		} else if reason, ok := ReservedReason(j, k); ok && Strict {
+			add(NewFinding(ReservedName, k, "Attribute `"+k+"` is a risky extension name for the HTTP binding (`ce-"+k+"` "+reason+")"))
+		}
+	}
+
+	findings = append(findings, CheckEnvelope(ctx, j)...)
+	findings = append(findings, CheckRegistry(ctx, j)...)
+
+	return DeduplicateFindings(findings)
+}
+
+// TruncateFindings keeps the first -max-findings findings and replaces the rest
+// with one finding that counts them.
+func TruncateFindings(findings []Finding) []Finding {
+	if MaxFindings <= 0 || len(findings) <= MaxFindings {
+		return findings
+	}
+
+	more := len(findings) - MaxFindings
+	kept := append([]Finding{}, findings[:MaxFindings]...)
+	return append(kept, *NewFinding(Truncated, "", "...and "+strconv.Itoa(more)+" more"))
+}
+
+// DeduplicateFindings drops the findings that repeat an earlier one and the
+// missing_required findings about an attribute that is present but null,
+// which is reported as null_value instead.
+func DeduplicateFindings(findings []Finding) []Finding {
+	null := make(map[string]bool)
+	for _, f := range findings {
+		if f.Code == NullValue {
+			null[f.Attribute] = true
+		}
+	}
+
+	deduplicated := findings[:0]
+	reported := make(map[Finding]bool, len(findings))
+	for _, f := range findings {
+		if reported[f] || (f.Code == MissingRequired && null[f.Attribute]) {
+			continue
+		}
+		reported[f] = true
+		deduplicated = append(deduplicated, f)
+	}
+
+	return deduplicated
+}
+
+// VerifyBatch runs the checks of a whole batch until ctx is done.
+func VerifyBatch(ctx context.Context, events []map[string]interface{}) []Finding {
+	var findings []Finding
+
+	for _, c := range BatchChecks {
+		if ctx.Err() != nil {
+			return append(findings, *NewFinding(Timeout, "", "Batch could not be verified as a whole ("+ctx.Err().Error()+")"))
+		}
+		if (!c.Strict || Strict) && (Only == "" || c.Attribute == Only) {
+			if f := c.Check(events); f != nil {
+				findings = append(findings, *f)
+			}
+		}
+	}
+
+	return findings
+}
+
+// EventIdentity is what identifies an event: producers must keep source and
+// id unique, so a repeated identity is a redelivery.
+type EventIdentity struct {
+	Source string `json:"source"`
+	ID     string `json:"id"`
+}
+
+// Deduper finds redelivered events in a stream of any length while only
+// remembering their identities, or only those of the last window events when
+// window is set.
+type Deduper struct {
+	window int
+	n      int
+	recent []EventIdentity
+	seen   map[EventIdentity]sighting
+}
+
+// sighting is how often an identity was seen and where it was seen last.
+type sighting struct {
+	count    int
+	position int
+}
+
+func NewDeduper() *Deduper {
+	return &Deduper{seen: make(map[EventIdentity]sighting)}
+}
+
+// observe records the identity of j, if it has a string source and id, and
+// returns it with the sighting before, if it is remembered.
+func (d *Deduper) observe(j map[string]interface{}) (EventIdentity, sighting, bool) {
+	position := d.n
+	d.n++
+
+	source, ok := j["source"].(string)
+	id, ok2 := j["id"].(string)
+
+	var identity EventIdentity
+	var previous sighting
+	seen := false
+	if ok && ok2 {
+		identity = EventIdentity{source, id}
+		previous, seen = d.seen[identity]
+		d.seen[identity] = sighting{previous.count + 1, position}
+	}
+
+	if d.window > 0 {
+		slot := position % d.window
+		if old, ok := d.seen[d.recent[slot]]; ok && old.position == position-d.window {
+			delete(d.seen, d.recent[slot])
+		}
+		d.recent[slot] = identity
+	}
+
+	return identity, previous, seen
+}
+
+// Add returns the identity of j and whether it is the first redelivery of
+// that identity; it is false for later redeliveries and for events without a
+// string source and id.
+func (d *Deduper) Add(j map[string]interface{}) (EventIdentity, bool) {
+	identity, previous, seen := d.observe(j)
+	return identity, seen && previous.count == 1
+}
+
+// DuplicateIdentities lists every identity that appears more than once in
+// events, in the order of their first redelivery.
+func DuplicateIdentities(events []map[string]interface{}) []EventIdentity {
+	d := NewDeduper()
+	var duplicates []EventIdentity
+
+	for _, j := range events {
+		if identity, ok := d.Add(j); ok {
+			duplicates = append(duplicates, identity)
+		}
+	}
+
+	return duplicates
+}
+
+// IDWindow finds ids that a source reuses within its last size events, which
+// is more likely an accident than a redelivery when the events differ.
+type IDWindow struct {
+	deduper *Deduper
+}
+
+// NewIDWindow is nil unless size is positive, which Check takes as disabled.
+func NewIDWindow(size int) *IDWindow {
+	if size <= 0 {
+		return nil
+	}
+	return &IDWindow{&Deduper{window: size, recent: make([]EventIdentity, size), seen: make(map[EventIdentity]sighting)}}
+}
+
+// Add returns the position of the previous event with the identity of j if it
+// is among the last size events.
+func (w *IDWindow) Add(j map[string]interface{}) (int, bool) {
+	identity, previous, seen := w.deduper.observe(j)
+	return previous.position, seen && identity.ID != ""
+}
+
+// Check adds j, the event at position i, and reports its id if the source
+// reused it within the window.
+func (w *IDWindow) Check(i int, j map[string]interface{}) *Finding {
+	if w == nil {
+		return nil
+	}
+
+	if prev, ok := w.Add(j); ok {
+		return NewFinding(DuplicateID, "id", fmt.Sprintf("Attribute `id` %q was already used by event %d of the same source, %d events earlier", j["id"], prev, i-prev))
+	}
+	return nil
+}
+
+type VersionResult struct {
+	Version string `json:"version"`
+	Result
+}
+
+// VerifyVersions verifies j as if its specversion were each of versions, to
+// show which versions of the specification it is compatible with.
+func VerifyVersions(j map[string]interface{}, versions []string) []VersionResult {
+	results := make([]VersionResult, 0, len(versions))
+
+	for _, version := range versions {
+		e := make(map[string]interface{}, len(j))
+		for k, v := range j {
+			e[k] = v
+		}
+		e["specversion"] = version
+
+		results = append(results, VersionResult{version, NewResult(Verify(e))})
+	}
+
+	return results
+}
+
+// MinimumVersion is the oldest of SpecVersions that j is valid for, which is
+// false when it is valid for none.
+func MinimumVersion(j map[string]interface{}) (string, bool) {
+	for _, r := range VerifyVersions(j, SpecVersions) {
+		if r.Valid {
+			return r.Version, true
+		}
+	}
+	return "", false
+}
+
+func HandleSinceSpecVersion(file string) int {
+	j, _, err := ReadEvent(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	version, ok := MinimumVersion(j)
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(struct {
+			Valid   bool   `json:"valid"`
+			Version string `json:"version,omitempty"`
+		}{ok, version}, "", JSONIndent)
+		fmt.Println(string(bytes))
+	} else if ok {
+		fmt.Println(version)
+	} else {
+		fmt.Fprintf(os.Stderr, "The event is invalid under all versions (%s)\n", strings.Join(SpecVersions, ", "))
+	}
+
+	return ExitStatus(ok)
+}
+
+// NewBatchResult verifies events, whose orders may be nil, as a batch.
+func NewBatchResult(ctx context.Context, events []map[string]interface{}, orders [][]string) BatchResult {
+	result := BatchResult{Findings: VerifyBatch(ctx, events), Events: make([]Result, len(events))}
+	if result.Findings == nil {
+		result.Findings = []Finding{}
+	}
+
+	result.Valid = len(result.Findings) == 0
+	window := NewIDWindow(IDWindowSize)
+	for i, j := range events {
+		var order []string
+		if i < len(orders) {
+			order = orders[i]
+		}
+
+		findings := VerifyOrdered(ctx, j, order)
+		if f := window.Check(i, j); f != nil {
+			findings = append(findings, *f)
+		}
+		result.Events[i] = NewResult(findings)
+		if ReportPassing {
+			result.Events[i].Passed = PassedAttributes(j, findings)
+		}
+		result.Valid = result.Valid && result.Events[i].Valid
+	}
+
+	return result
+}
+
+// PassedAttributes lists the attributes of j that were checked without any
+// finding.
+func PassedAttributes(j map[string]interface{}, findings []Finding) []string {
+	failed := make(map[string]bool, len(findings))
+	for _, f := range findings {
+		failed[f.Attribute] = true
+	}
+
+	var passed []string
+	for k := range j {
+		if !failed[k] && k != "data" && k != "data_base64" && (Only == "" || k == Only) {
+			passed = append(passed, k)
+		}
+	}
+	sort.Strings(passed)
+
+	return passed
+}
+
+func VerifyJSON(j map[string]interface{}) string {
+	return FormatFindings(Verify(j))
+}
+
+func CheckDepth(b []byte) error {
+	if MaxDepth <= 0 {
+		return nil
+	}
+
+	var tooDeep error
+	WalkJSON(json.NewDecoder(bytes.NewReader(b)), b, JSONVisitor{
+		Enter: func(pointer string, depth int) error {
+			if depth > MaxDepth {
+				tooDeep = fmt.Errorf("JSON is nested too deeply (more than %d levels)", MaxDepth)
+			}
+			return tooDeep
+		},
+	})
+
+	// syntax errors are left for the real decode to report
+	return tooDeep
+}
+
+// CheckStrictJSON rejects what RFC 8259 does not allow or leaves undefined
+// but encoding/json accepts: invalid UTF-8 and unpaired surrogate escapes,
+// which it replaces with U+FFFD, duplicate keys, of which it keeps the last,
+// and content after the value, which a decoder never reads. Leading zeros,
+// NaN and Infinity are rejected by encoding/json already.
+func CheckStrictJSON(b []byte) error {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return fmt.Errorf("invalid UTF-8 at byte %d", i)
+		}
+		i += size
+	}
+
+	if err := checkSurrogates(b); err != nil {
+		return err
+	}
+
+	var duplicate error
+	objects := make(map[string]map[string]bool)
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	err := WalkJSON(decoder, b, JSONVisitor{
+		Member: func(object string, key string) error {
+			if objects[object] == nil {
+				objects[object] = make(map[string]bool)
+			}
+			if objects[object][key] {
+				duplicate = errors.New("duplicate key " + strconv.Quote(key) + " at " + strconv.Quote(object+"/"+EscapePointerToken(key)))
+				return duplicate
+			}
+			objects[object][key] = true
+			return nil
+		},
+		Leave: func(pointer string, span Span, keys []string) error {
+			delete(objects, pointer)
+			return nil
+		},
+	})
+	if duplicate != nil {
+		return duplicate
+	}
+	if err != nil {
+		// syntax errors are left for the real decode to report
+		return nil
+	}
+
+	rest := bytes.TrimLeft(b[decoder.InputOffset():], " \t\r\n")
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected content after the JSON value at byte %d", len(b)-len(rest))
+	}
+
+	return nil
+}
+
+func checkSurrogates(b []byte) error {
+	surrogate := func(i int, min uint64, max uint64) bool {
+		if i+6 > len(b) || b[i] != '\\' || b[i+1] != 'u' {
+			return false
+		}
+		r, err := strconv.ParseUint(string(b[i+2:i+6]), 16, 32)
+		return err == nil && r >= min && r <= max
+	}
+
+	for i, inString := 0, false; i < len(b); i++ {
+		switch {
+		case b[i] == '"':
+			inString = !inString
+		case !inString || b[i] != '\\':
+		case surrogate(i, 0xD800, 0xDBFF) && surrogate(i+6, 0xDC00, 0xDFFF):
+			i += 11
+		case surrogate(i, 0xD800, 0xDFFF):
+			return fmt.Errorf("unpaired surrogate %s at byte %d", b[i:i+6], i)
+		default:
+			// the escaped character cannot end the string
+			i++
+		}
+	}
+
+	return nil
+}
+
+// EscapePointerToken escapes a key as a reference token of a JSON pointer.
+func EscapePointerToken(k string) string {
+	return strings.Replace(strings.Replace(k, "~", "~0", -1), "/", "~1", -1)
+}
+
+func ResolvePointer(doc interface{}, pointer string) (interface{}, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with '/'", pointer)
+	}
+
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if doc, ok = v[token]; !ok {
+				return nil, fmt.Errorf("JSON pointer %q does not resolve (no member %q)", pointer, token)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("JSON pointer %q does not resolve (no index %q)", pointer, token)
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("JSON pointer %q does not resolve (%q is not in an object or array)", pointer, token)
+		}
+	}
+
+	return doc, nil
+}
+
+// CanonicalAttributes is the order of -canonical-order: these attributes
+// first, then every other attribute and extension, then the data.
+var CanonicalAttributes = []string{"specversion", "id", "source", "type", "datacontenttype", "dataschema", "subject", "time"}
+
+// MemberOrders returns the order of the members of the event at pointer of a
+// JSON document, or of each event when it is a batch, which their maps forget.
+// It is nil unless -canonical-order is set.
+func MemberOrders(body []byte, pointer string) [][]string {
+	if !CanonicalOrder {
+		return nil
+	}
+
+	// the keys of the objects at pointer and of its elements, keeping the
+	// first of duplicate members like the order they are reported in
+	objects := make(map[string][]string)
+	body = bytes.TrimPrefix(body, BOM)
+	err := WalkJSON(json.NewDecoder(bytes.NewReader(body)), body, JSONVisitor{
+		Leave: func(current string, span Span, keys []string) error {
+			parent := ""
+			if i := strings.LastIndex(current, "/"); i >= 0 {
+				parent = current[:i]
+			}
+			if keys == nil || (current != pointer && (current == "" || parent != pointer)) {
+				return nil
+			}
+
+			seen := make(map[string]bool, len(keys))
+			unique := make([]string, 0, len(keys))
+			for _, k := range keys {
+				if !seen[k] {
+					seen[k] = true
+					unique = append(unique, k)
+				}
+			}
+			objects[current] = unique
+			return nil
+		},
+	})
+	if err != nil {
+		return nil
+	}
+
+	if keys, ok := objects[pointer]; ok {
+		return [][]string{keys}
+	}
+
+	var orders [][]string
+	for i := 0; ; i++ {
+		keys, ok := objects[pointer+"/"+strconv.Itoa(i)]
+		if !ok {
+			return orders
+		}
+		orders = append(orders, keys)
+	}
+}
+
+// Span is the byte range [Start, End) of a member or element of a JSON
+// document, from the key of a member to the end of its value.
+type Span struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Spans walks the tokens of a JSON document and returns the span of every
+// member and element by its JSON pointer, "" being the whole document.
+func Spans(body []byte) (map[string]Span, error) {
+	spans := make(map[string]Span)
+	err := WalkJSON(json.NewDecoder(bytes.NewReader(body)), body, JSONVisitor{
+		Leave: func(pointer string, span Span, keys []string) error {
+			spans[pointer] = span
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return spans, nil
+}
+
+// skipSeparators is the offset of the next token at or after offset, since
+// the decoder's offset is the end of the previous one.
+func skipSeparators(body []byte, offset int64) int64 {
+	for offset < int64(len(body)) && strings.IndexByte(" \t\r\n,:", body[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// JSONVisitor has the callbacks of WalkJSON, any of which may be nil. An
+// error returned by one stops the walk.
+type JSONVisitor struct {
+	// Enter is called when an object or array starts, with the number of
+	// objects and arrays it is in including itself.
+	Enter func(pointer string, depth int) error
+	// Member is called with each key of an object as it is read, before its
+	// value.
+	Member func(object string, key string) error
+	// Leave is called when a value ends, with its span and the keys of an
+	// object in order, duplicates included, which are nil for other values.
+	Leave func(pointer string, span Span, keys []string) error
+}
+
+// WalkJSON walks the tokens of the next JSON value of decoder, which reads
+// body, for what decoding forgets: the order of members, duplicate keys and
+// where each value is.
+func WalkJSON(decoder *json.Decoder, body []byte, visitor JSONVisitor) error {
+	return walkJSON(decoder, body, "", 0, skipSeparators(body, decoder.InputOffset()), visitor)
+}
+
+func walkJSON(decoder *json.Decoder, body []byte, pointer string, depth int, start int64, visitor JSONVisitor) error {
+	t, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	if t == json.Delim('{') {
+		keys = []string{}
+	}
+	if t == json.Delim('{') || t == json.Delim('[') {
+		if visitor.Enter != nil {
+			if err := visitor.Enter(pointer, depth+1); err != nil {
+				return err
+			}
+		}
+
+		for i := 0; decoder.More(); i++ {
+			offset := skipSeparators(body, decoder.InputOffset())
+			p := pointer + "/" + strconv.Itoa(i)
+			if t == json.Delim('{') {
+				k, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+
+				keys = append(keys, k.(string))
+				if visitor.Member != nil {
+					if err := visitor.Member(pointer, k.(string)); err != nil {
+						return err
+					}
+				}
+				p = pointer + "/" + EscapePointerToken(k.(string))
+			}
+
+			if err := walkJSON(decoder, body, p, depth+1, offset, visitor); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	if visitor.Leave != nil {
+		return visitor.Leave(pointer, Span{start, decoder.InputOffset()}, keys)
+	}
+	return nil
+}
+
+// LocatedFinding is a finding with the JSON pointer and span of its attribute
+// in the input, which are left out when the attribute is not in it.
+type LocatedFinding struct {
+	Finding
+	Pointer string `json:"pointer,omitempty"`
+	Span    *Span  `json:"span,omitempty"`
+}
+
+// LocateFindings finds the attributes of the findings of the event at pointer.
+func LocateFindings(findings []Finding, pointer string, spans map[string]Span) []LocatedFinding {
+	located := make([]LocatedFinding, len(findings))
+	for i, f := range findings {
+		located[i].Finding = f
+		if f.Attribute == "" {
+			continue
+		}
+
+		p := pointer + "/" + EscapePointerToken(f.Attribute)
+		if span, ok := spans[p]; ok {
+			located[i].Pointer = p
+			located[i].Span = &span
+		}
+	}
+	return located
+}
+
+// HandleJSONPointerErrors verifies the structured JSON events of a file and
+// reports every finding with the byte offsets of its attribute in the file.
+func HandleJSONPointerErrors(file string) int {
+	body, err := ReadInput(file)
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+
+	events, batch, err := ParseInput(bytes.NewReader(body), "json", true)
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+
+	// the offsets are those of the file as is, byte order mark included
+	trimmed := bytes.TrimPrefix(body, BOM)
+	spans, err := Spans(trimmed)
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+	if bom := int64(len(body) - len(trimmed)); bom > 0 {
+		for p, span := range spans {
+			spans[p] = Span{span.Start + bom, span.End + bom}
+		}
+	}
+
+	orders := InputOrders(body, "json")
+	located := []LocatedFinding{}
+	for i, j := range events {
+		pointer := JSONPointer
+		if batch {
+			pointer += "/" + strconv.Itoa(i)
+		}
+
+		var order []string
+		if i < len(orders) {
+			order = orders[i]
+		}
+		located = append(located, LocateFindings(VerifyOrdered(context.Background(), j, order), pointer, spans)...)
+	}
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(located, "", JSONIndent)
+		fmt.Println(string(bytes))
+	} else {
+		for _, f := range located {
+			if f.Span != nil {
+				fmt.Fprintf(os.Stderr, "%d-%d: ", f.Span.Start, f.Span.End)
+			}
+			fmt.Fprintln(os.Stderr, Explain(f.Finding))
+		}
+	}
+
+	return ExitStatus(len(located) == 0)
+}
+
+// CheckOrder reports the first member in the order of MemberOrders that comes
+// after one it should precede.
+func CheckOrder(order []string) *Finding {
+	if !CanonicalOrder || Only != "" {
+		return nil
+	}
+
+	rank := func(k string) int {
+		for i, a := range CanonicalAttributes {
+			if k == a {
+				return i
+			}
+		}
+		if k == "data" || k == "data_base64" {
+			return len(CanonicalAttributes) + 1
+		}
+		return len(CanonicalAttributes)
+	}
+
+	last := ""
+	for _, k := range order {
+		if last != "" && rank(k) < rank(last) {
+			return NewFinding(OutOfOrder, k, "Attribute `"+k+"` comes after `"+last+"` but should come before it (the canonical order is "+strings.Join(CanonicalAttributes, ", ")+", other attributes and extensions, then data)")
+		}
+		if last == "" || rank(k) > rank(last) {
+			last = k
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalNumbers is json.Unmarshal keeping numbers as json.Number, so that
+// the text of an Integer is checked rather than the float64 it rounds to.
+func UnmarshalNumbers(b []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+func DecodeDocument(body []byte, useNumber bool) (interface{}, error) {
+	if err := CheckDepth(body); err != nil {
+		return nil, err
+	}
+	if StrictJSON {
+		if err := CheckStrictJSON(body); err != nil {
+			return nil, err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if useNumber {
+		decoder.UseNumber()
+	}
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return ResolvePointer(doc, JSONPointer)
+}
+
+// JSONType names the JSON type of a decoded value, for messages about a
+// document that has the wrong one.
+func JSONType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64, json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return "of type " + reflect.TypeOf(v).String()
+}
+
+func ParseEvent(body []byte, useNumber bool) (map[string]interface{}, error) {
+	doc, err := DecodeDocument(body, useNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	j, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("a CloudEvent must be a JSON object (is currently %s)", JSONType(doc))
+	}
+
+	return j, nil
+}
+
+func EventsFromDocument(doc interface{}) ([]map[string]interface{}, bool, error) {
+	if j, ok := doc.(map[string]interface{}); ok {
+		return []map[string]interface{}{j}, false, nil
+	}
+
+	a, ok := doc.([]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("a CloudEvent must be a JSON object or an array of them (is currently %s)", JSONType(doc))
+	}
+
+	events := make([]map[string]interface{}, len(a))
+	for i, e := range a {
+		if events[i], ok = e.(map[string]interface{}); !ok {
+			return nil, true, fmt.Errorf("event %d of the batch must be a JSON object (is currently %s)", i, JSONType(e))
+		}
+	}
+
+	return events, true, nil
+}
+
+// ParseEvents accepts either a single event or a batch (a JSON array of
+// events) and reports which one it was.
+func ParseEvents(body []byte, useNumber bool) ([]map[string]interface{}, bool, error) {
+	doc, err := DecodeDocument(body, useNumber)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return EventsFromDocument(doc)
+}
+
+// BOM is the UTF-8 byte order mark that editors on Windows like to start files
+// with, which encoding/json rejects as an invalid character.
+var BOM = []byte("\xef\xbb\xbf")
+
+var InputFormats = []string{"auto", "json", "yaml", "ndjson"}
+
+func DetectFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	}
+	return "json"
+}
+
+// ParseInput reads events in the given format; an NDJSON stream is always
+// treated as a batch with one event per non-empty line.
+func ParseInput(r io.Reader, format string, useNumber bool) ([]map[string]interface{}, bool, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+	body = bytes.TrimPrefix(body, BOM)
+
+	switch format {
+	case "json":
+		return ParseEvents(body, useNumber)
+	case "yaml":
+		doc, err := ParseYAML(body, useNumber)
+		if err == nil {
+			doc, err = ResolvePointer(doc, JSONPointer)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return EventsFromDocument(doc)
+	case "ndjson":
+		var events []map[string]interface{}
+		for i, line := range bytes.Split(body, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+
+			j, err := ParseEvent(line, useNumber)
+			if err != nil {
+				return nil, true, fmt.Errorf("line %d: %s", i+1, err)
+			}
+			events = append(events, j)
+		}
+		return events, true, nil
+	}
+
+	return nil, false, fmt.Errorf("unknown input format %q", format)
+}
+
+// InputOrders are the MemberOrders of the events ParseInput reads from body in
+// the given format, nil for YAML.
+func InputOrders(body []byte, format string) [][]string {
+	switch format {
+	case "json":
+		return MemberOrders(body, JSONPointer)
+	case "ndjson":
+		var orders [][]string
+		for _, line := range bytes.Split(bytes.TrimPrefix(body, BOM), []byte("\n")) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				orders = append(orders, EventOrder(line, JSONPointer))
+			}
+		}
+		return orders
+	}
+	return nil
+}
+
+// EventOrder is the order of the members of the single event at pointer of
+// body.
+func EventOrder(body []byte, pointer string) []string {
+	if orders := MemberOrders(body, pointer); len(orders) == 1 {
+		return orders[0]
+	}
+	return nil
+}
+
+// ScanNDJSON calls fn with the index of each event of an NDJSON stream as soon
+// as its line is read, so that a stream of any length needs bounded memory,
+// along with the EventOrder of the line. A line that is not an event ends the
+// scan with its error, so fn is never given one.
+func ScanNDJSON(r io.Reader, useNumber bool, fn func(int, map[string]interface{}, []string, error)) error {
+	i := 0
+	return ScanLines(r, func(line int, b []byte) error {
+		j, err := ParseEvent(b, useNumber)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+
+		fn(i, j, EventOrder(b, JSONPointer), nil)
+		i++
+		return nil
+	})
+}
+
+// ScanLines calls fn with the number and content of each line of an NDJSON
+// stream that is not blank, without the byte order mark of the first, until
+// fn returns an error.
+func ScanLines(r io.Reader, fn func(int, []byte) error) error {
+	scanner := NewLineScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		b := scanner.Bytes()
+		if line == 1 {
+			b = bytes.TrimPrefix(b, BOM)
+		}
+
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+
+		if err := fn(line, b); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ScanSSE calls fn with every event carried by the data of a Server-Sent Events
+// stream. The data lines of a frame are joined with newlines and the frame is
+// dispatched at the blank line ending it, so a frame cut off at the end of the
+// stream is discarded as the SSE specification requires. A frame that is not an
+// event is given to fn as an error and the scan carries on with the next one.
+func ScanSSE(r io.Reader, useNumber bool, fn func(int, map[string]interface{}, []string, error)) error {
+	scanner := NewLineScanner(r)
+
+	i := 0
+	var data []string
+	for line := 1; scanner.Scan(); line++ {
+		b := scanner.Text()
+		if line == 1 {
+			b = strings.TrimPrefix(b, string(BOM))
+		}
+
+		if b == "" {
+			if data == nil {
+				continue
+			}
+
+			b := []byte(strings.Join(data, "\n"))
+			if j, err := ParseEvent(b, useNumber); err != nil {
+				fn(i, nil, nil, fmt.Errorf("event ending on line %d: %s", line, err))
+			} else {
+				fn(i, j, EventOrder(b, JSONPointer), nil)
+			}
+			i++
+			data = nil
+			continue
+		}
+
+		// lines starting with a colon are comments and other fields such as
+		// event, id and retry do not carry the CloudEvent
+		field, value := b, ""
+		if c := strings.Index(b, ":"); c >= 0 {
+			field, value = b[:c], strings.TrimPrefix(b[c+1:], " ")
+		}
+		if field == "data" {
+			data = append(data, value)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// NewLineScanner scans the lines of r, each of which may be up to -max-body-size
+// long.
+func NewLineScanner(r io.Reader) *bufio.Scanner {
+	max := math.MaxInt32
+	if MaxBodySize > 0 && MaxBodySize < int64(max) {
+		max = int(MaxBodySize)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), max)
+	return scanner
+}
+
+// Pipe copies the lines of an NDJSON stream that are valid events from r to w
+// unchanged and reports every other line to log instead, returning how many
+// were dropped.
+func Pipe(r io.Reader, w io.Writer, log io.Writer) (int, error) {
+	dropped := 0
+	err := ScanLines(r, func(line int, b []byte) error {
+		j, err := ParseEvent(b, true)
+		if err != nil {
+			fmt.Fprintf(log, "Line %d dropped: %s\n", line, err)
+			dropped++
+			return nil
+		}
+
+		if findings := Verify(j); len(findings) > 0 {
+			fmt.Fprintf(log, "Line %d dropped:\n%s", line, FormatFindings(findings))
+			dropped++
+			return nil
+		}
+
+		if Redact {
+			b, _ = json.Marshal(Redacted(j))
+		}
+		w.Write(b)
+		fmt.Fprintln(w)
+		return nil
+	})
+
+	return dropped, err
+}
+
+func HandlePipe() int {
+	dropped, err := Pipe(os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return ExitStatus(dropped == 0)
+}
+
+// NeedsBatch reports whether an enabled check has to see every event of a
+// batch at once.
+func NeedsBatch() bool {
+	for _, c := range BatchChecks {
+		if !c.Strict || Strict {
+			return true
+		}
+	}
+	return false
+}
+
+func ReadInput(file string) ([]byte, error) {
+	if file == "-" {
+		return ReadStdin(os.Stdin)
+	}
+	return ioutil.ReadFile(file)
+}
+
+func ReadStdin(r io.Reader) ([]byte, error) {
+	body, err := ioutil.ReadAll(r)
+	if err == nil && len(bytes.TrimSpace(body)) == 0 {
+		return nil, ErrNoInput
+	}
+	return body, err
+}
+
+// limitedReader reads the bytes of r until they exceed n, when it fails with
+// ErrBodyTooLarge.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n - 1, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// LimitBody bounds what is read of r by -max-body-size.
+func LimitBody(r io.Reader) io.Reader {
+	if MaxBodySize <= 0 {
+		return r
+	}
+	return &limitedReader{r, MaxBodySize}
+}
+
+func ReadLimited(r io.Reader) ([]byte, error) {
+	if MaxBodySize <= 0 {
+		return ioutil.ReadAll(r)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r, MaxBodySize+1))
+	if err == nil && int64(len(body)) > MaxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return body, err
+}
+
+// Fetch sends req within -read-timeout and reads the body of the response,
+// which is returned even if reading it fails, with ReadLimited.
+func Fetch(req *http.Request) (*http.Response, []byte, error) {
+	client := &http.Client{Timeout: ReadTimeout}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ReadLimited(resp.Body)
+	return resp, body, err
+}
+
+func FetchURL(addr string) ([]byte, error) {
+	req, err := http.NewRequest("GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, body, err := Fetch(req)
+	if resp != nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return nil, fmt.Errorf("fetching %s returned %s", addr, resp.Status)
+	}
+
+	return body, err
+}
+
+// ReadEvent reads the single event of file along with the order of its
+// members, which is nil unless -canonical-order is set.
+func ReadEvent(file string) (map[string]interface{}, []string, error) {
+	body, err := ReadInput(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events, batch, err := ParseInput(bytes.NewReader(body), InputFormat(file), true)
+	if err != nil {
+		return nil, nil, err
+	} else if batch {
+		return nil, nil, errors.New("expected a single CloudEvent, not a batch")
+	}
+
+	var order []string
+	if orders := InputOrders(body, InputFormat(file)); len(orders) == 1 {
+		order = orders[0]
+	}
+
+	return events[0], order, nil
+}
+
+func VerifyFile(file string) ([]Finding, error) {
+	j, order, err := ReadEvent(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return VerifyOrdered(context.Background(), j, order), nil
+}
+
+var Fixes = []func(map[string]interface{}){
+	FixAttributeNames,
+	FixPercentEncoding,
+	FixURISchemes,
+}
+
+// FixAttributeNames lowercases attribute names that are only invalid because
+// of their case, unless that would overwrite another attribute.
+func FixAttributeNames(j map[string]interface{}) {
+	for k, v := range j {
+		l := strings.ToLower(k)
+		if _, ok := j[l]; !ok && l != k && len(AttributeNamePattern.FindString(l)) == len(l) {
+			delete(j, k)
+			j[l] = v
+		}
+	}
+}
+
+// FixPercentEncoding percent-encodes the characters of URIs that are not
+// allowed in them, including a '%' that does not start an octet, and
+// uppercases the hex digits of the octets that are already encoded.
+func FixPercentEncoding(j map[string]interface{}) {
+	for _, e := range Attributes {
+		uri, ok := j[e.Name].(string)
+		if !ok || (e.Type != "URI" && e.Type != "URI-reference") {
+			continue
+		}
+
+		var fixed strings.Builder
+		for i := 0; i < len(uri); i++ {
+			if uri[i] == '%' && IsPercentEncoded(uri, i) {
+				fixed.WriteString(strings.ToUpper(uri[i : i+3]))
+				i += 2
+			} else if uri[i] == '%' || !strings.Contains(URICharacters, string(uri[i])) {
+				fmt.Fprintf(&fixed, "%%%02X", uri[i])
+			} else {
+				fixed.WriteByte(uri[i])
+			}
+		}
+		j[e.Name] = fixed.String()
+	}
+}
+
+func FixURISchemes(j map[string]interface{}) {
+	for _, e := range Attributes {
+		if uri, ok := j[e.Name].(string); ok && (e.Type == "URI" || e.Type == "URI-reference") {
+			if u, err := url.Parse(uri); err == nil {
+				j[e.Name] = NormalizeScheme(uri, u)
+			}
+		}
+	}
+}
+
+func FixEvent(j map[string]interface{}) map[string]interface{} {
+	for _, fix := range Fixes {
+		fix(j)
+	}
+	return j
+}
+
+// ParseIndent turns a -json-indent of a number of spaces or "tab" into the
+// indentation itself.
+func ParseIndent(s string) (string, error) {
+	if s == "tab" {
+		return "\t", nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 16 {
+		return "", fmt.Errorf("indent %q is neither 0 to 16 spaces nor \"tab\"", s)
+	}
+	return strings.Repeat(" ", n), nil
+}
+
+func MarshalEvent(j map[string]interface{}) ([]byte, error) {
+	if CompactJSON {
+		return json.Marshal(j)
+	}
+	return json.MarshalIndent(j, "", JSONIndent)
+}
+
+func HandleVersions(file string, versions []string) int {
+	j, _, err := ReadEvent(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	results := VerifyVersions(j, versions)
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(results, "", JSONIndent)
+		fmt.Println(string(bytes))
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tVALID\tFINDINGS")
+	for _, r := range results {
+		codes := strings.Join(FindingCodes(nil, r.Findings), ", ")
+		fmt.Fprintf(w, "%s\t%t\t%s\n", r.Version, r.Valid, codes)
+	}
+	w.Flush()
+
+	return 0
+}
+
+func HandleFix(file string) int {
+	j, _, err := ReadEvent(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fixed := FixEvent(j)
+	if Redact {
+		fixed = Redacted(fixed)
+	}
+
+	bytes, err := MarshalEvent(fixed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(bytes))
+
+	findings := Verify(j)
+	fmt.Fprint(os.Stderr, FormatFindings(findings))
+	if AssertInvalid {
+		fmt.Fprint(os.Stderr, AssertionSummary(FindingCodes(nil, findings)))
+	}
+
+	return ExitStatus(len(findings) == 0)
+}
+
+// NewResult is the result of findings, of which it reports at most
+// -max-findings.
+func NewResult(findings []Finding) Result {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	return Result{Valid: len(findings) == 0, Findings: TruncateFindings(findings), codes: FindingCodes(nil, findings)}
+}
+
+func Report(events []map[string]interface{}, orders [][]string, batch bool, err error) int {
+	if err != nil {
+		if Output == "json" || Output == "jsonl" {
+			result := NewResult(nil)
+			result.Valid = false
+			result.Error = err.Error()
+
+			var bytes []byte
+			if Output == "jsonl" {
+				bytes, _ = json.Marshal(result)
+			} else {
+				bytes, _ = json.MarshalIndent(result, "", JSONIndent)
+			}
+			fmt.Println(string(bytes))
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		if err == ErrNoInput {
+			flag.Usage()
+			return 2
+		}
+		return 1
+	}
+
+	result := NewBatchResult(context.Background(), events, orders)
+
+	if Output == "json" {
+		var bytes []byte
+		if batch {
+			bytes, _ = json.MarshalIndent(result, "", JSONIndent)
+		} else {
+			bytes, _ = json.MarshalIndent(result.Events[0], "", JSONIndent)
+		}
+		fmt.Println(string(bytes))
+	} else if Output == "jsonl" {
+		if len(result.Findings) > 0 {
+			WriteJSONLine(os.Stdout, LineResult{Result: NewResult(result.Findings)})
+		}
+		for i, r := range result.Events {
+			WriteJSONLine(os.Stdout, EventLineResult(events[i], r))
+		}
+	} else {
+		PrintPerformedChecks()
+		WriteReport(os.Stderr, result, batch)
+
+		if AssertInvalid {
+			fmt.Fprint(os.Stderr, AssertionSummary(ResultCodes(result)))
+		}
+	}
+
+	return ExitStatus(result.Valid)
+}
+
+// WriteReport writes the findings of result as text.
+func WriteReport(w io.Writer, result BatchResult, batch bool) {
+	if len(result.Findings) > 0 {
+		fmt.Fprintf(w, "Batch:\n%s", FormatFindings(result.Findings))
+	}
+	for i, r := range result.Events {
+		WriteEventReport(w, i, r, batch)
+	}
+}
+
+func WriteEventReport(w io.Writer, i int, r Result, batch bool) {
+	if batch && (!r.Valid || len(r.Passed) > 0) {
+		fmt.Fprintf(w, "Event %d:\n", i)
+	}
+	fmt.Fprint(w, FormatFindings(r.Findings))
+	for _, k := range r.Passed {
+		fmt.Fprintf(w, "Attribute `%s` passed\n", k)
+	}
+}
+
+// ResultCodes are the codes of the findings of result, including those
+// beyond -max-findings.
+func ResultCodes(result BatchResult) []string {
+	codes := FindingCodes(nil, result.Findings)
+	for _, r := range result.Events {
+		for _, c := range r.codes {
+			if !StringInSlice(c, codes) {
+				codes = append(codes, c)
+			}
+		}
+	}
+	return codes
+}
+
+// ExitStatus is the exit status for a verified input, which -assert-invalid
+// inverts.
+func ExitStatus(valid bool) int {
+	if valid == AssertInvalid {
+		return 1
+	}
+	return 0
+}
+
+// FindingCodes appends the codes of findings that are not in codes yet.
+func FindingCodes(codes []string, findings []Finding) []string {
+	for _, f := range findings {
+		if !StringInSlice(f.Code, codes) {
+			codes = append(codes, f.Code)
+		}
+	}
+	return codes
+}
+
+func AssertionSummary(codes []string) string {
+	if len(codes) == 0 {
+		return "Expected the input to be invalid, but it passed every check\n"
+	}
+	return "Invalid as expected (" + strings.Join(codes, ", ") + ")\n"
+}
+
+//go:embed fixtures
+var Fixtures embed.FS
+
+type FixtureResult struct {
+	Name     string
+	Expected bool
+	Valid    bool
+}
+
+// VerifyFixtures verifies every file of fixtures/valid and fixtures/invalid in
+// fsys, which hold example events that are known to be valid or invalid.
+func VerifyFixtures(fsys fs.FS) ([]FixtureResult, error) {
+	var results []FixtureResult
+
+	err := fs.WalkDir(fsys, "fixtures", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		events, _, err := ParseEvents(body, true)
+		results = append(results, FixtureResult{
+			Name:     name,
+			Expected: strings.HasPrefix(name, "fixtures/valid/"),
+			Valid:    err == nil && NewBatchResult(context.Background(), events, nil).Valid,
+		})
+		return nil
+	})
+
+	return results, err
+}
+
+func HandleVerifyFixtures() int {
+	results, err := VerifyFixtures(Fixtures)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	failed := false
+	for _, r := range results {
+		expected := "invalid"
+		if r.Expected {
+			expected = "valid"
+		}
+
+		if r.Valid == r.Expected {
+			fmt.Printf("ok    %s\n", r.Name)
+		} else {
+			failed = true
+			fmt.Printf("FAIL  %s (expected the fixture to be %s)\n", r.Name, expected)
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// SampleEvent is a valid event with most attributes set.
+func SampleEvent() map[string]interface{} {
+	return map[string]interface{}{
+		"specversion":     "1.0",
+		"type":            "com.example.someevent",
+		"source":          "/mycontext",
+		"id":              "A234-1234-1234",
+		"time":            "2018-04-05T17:31:00Z",
+		"subject":         "sample",
+		"datacontenttype": "application/json",
+		"data":            map[string]interface{}{"message": "hello"},
+	}
+}
+
+// Defect breaks a sample event so that it is reported with Code.
+type Defect struct {
+	Name  string
+	Code  string
+	Apply func(map[string]interface{})
+}
+
+var Defects = []Defect{
+	{"missing-id", MissingRequired, func(j map[string]interface{}) { delete(j, "id") }},
+	{"empty-source", EmptyString, func(j map[string]interface{}) { j["source"] = "" }},
+	{"bad-time", InvalidTimestamp, func(j map[string]interface{}) { j["time"] = "2018-04-05 17:31" }},
+	{"numeric-specversion", WrongType, func(j map[string]interface{}) { j["specversion"] = 1.0 }},
+	{"null-subject", NullValue, func(j map[string]interface{}) { j["subject"] = nil }},
+	{"bad-datacontenttype", InvalidMediaType, func(j map[string]interface{}) { j["datacontenttype"] = "json" }},
+	{"bad-dataschema", InvalidURI, func(j map[string]interface{}) { j["dataschema"] = "not a uri" }},
+	{"uppercase-extension", BadExtensionName, func(j map[string]interface{}) { j["Example"] = "value" }},
+	{"dataschema-0.3", WrongVersion, func(j map[string]interface{}) {
+		j["specversion"] = "0.3"
+		j["dataschema"] = "https://example.com/schema"
+	}},
+}
+
+func DefectNames() []string {
+	names := make([]string, len(Defects))
+	for i, d := range Defects {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// SampleInvalidEvent is the sample event with the defect of the given name.
+func SampleInvalidEvent(name string) (map[string]interface{}, error) {
+	for _, d := range Defects {
+		if d.Name == name {
+			j := SampleEvent()
+			d.Apply(j)
+			return j, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown defect %q (known are %s)", name, strings.Join(DefectNames(), ", "))
+}
+
+func HandleSampleInvalid(name string) int {
+	j, err := SampleInvalidEvent(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	bytes, _ := json.MarshalIndent(j, "", JSONIndent)
+	fmt.Println(string(bytes))
+	return 0
+}
+
+// Vector is a generated test case, an event and whether it is valid or else
+// the code it is reported with. Vectors assume that no rules are loaded and
+// that no flag other than -strict is set, and Strict records whether it is.
+type Vector struct {
+	Name   string                 `json:"name"`
+	Strict bool                   `json:"strict"`
+	Valid  bool                   `json:"valid"`
+	Code   string                 `json:"code,omitempty"`
+	Event  map[string]interface{} `json:"event"`
+}
+
+// VectorValues are valid values of the attribute types the sample event does
+// not already have a value for.
+var VectorValues = map[string]interface{}{
+	"Encoding": "base64",
+	"URI":      "https://example.com/schema",
+}
+
+// GenerateVectors derives test vectors for every attribute and for the
+// EventChecks that no flag but -strict enables from the sample event,
+// followed by the defects that are not covered by them.
+func GenerateVectors() []Vector {
+	vectors := []Vector{{Name: "sample", Valid: true, Event: SampleEvent()}}
+	add := func(name string, code string, change func(map[string]interface{})) {
+		j := SampleEvent()
+		change(j)
+		vectors = append(vectors, Vector{Name: name, Valid: code == "", Code: code, Event: j})
+	}
+
+	for _, e := range Attributes {
+		e := e
+		// Attributes of one specversion only are tested in events of it.
+		version := func(j map[string]interface{}) {}
+		if e.Versions != nil {
+			version = func(j map[string]interface{}) { j["specversion"] = e.Versions[0] }
+
+			add("wrong-version-"+e.Name, WrongVersion, func(j map[string]interface{}) {
+				j["specversion"] = "1.0"
+				if e.Versions[0] == "1.0" {
+					j["specversion"] = "0.3"
+				}
+				j[e.Name] = VectorValues[e.Type]
+			})
+			add("valid-"+e.Name, "", func(j map[string]interface{}) {
+				version(j)
+				j[e.Name] = VectorValues[e.Type]
+			})
+		}
+
+		if e.Required {
+			add("missing-"+e.Name, MissingRequired, func(j map[string]interface{}) { delete(j, e.Name) })
+		}
+		add("null-"+e.Name, NullValue, func(j map[string]interface{}) {
+			version(j)
+			j[e.Name] = nil
+		})
+		add("wrong-type-"+e.Name, WrongType, func(j map[string]interface{}) {
+			version(j)
+			j[e.Name] = true
+		})
+	}
+
+	for _, c := range EventChecks {
+		if c.Vector == nil || c.Flag != "" {
+			continue
+		}
+		add(strings.Replace(c.Code, "_", "-", -1), c.Code, c.Vector)
+		vectors[len(vectors)-1].Strict = c.Strict
+	}
+
+	seen := make(map[string]bool, len(vectors))
+	for _, v := range vectors {
+		seen[v.Name] = true
+	}
+	for _, d := range Defects {
+		if !seen[d.Name] {
+			add(d.Name, d.Code, d.Apply)
+		}
+	}
+
+	return vectors
+}
+
+func HandleGenVectors(file string) int {
+	bytes, _ := json.MarshalIndent(GenerateVectors(), "", JSONIndent)
+	bytes = append(bytes, '\n')
+
+	if file == "-" {
+		os.Stdout.Write(bytes)
+		return 0
+	}
+
+	if err := ioutil.WriteFile(file, bytes, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func InputFormat(name string) string {
+	if Format == "auto" {
+		return DetectFormat(name)
+	}
+	return Format
+}
+
+func HandleFile(file string) int {
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		return HandleDirectory(file)
+	}
+
+	if InputFormat(file) == "ndjson" && Output != "json" && !NeedsBatch() {
+		return StreamFile(file)
+	}
+
+	body, err := ReadInput(file)
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+
+	events, batch, err := ParseInput(bytes.NewReader(body), InputFormat(file), true)
+	return Report(events, InputOrders(body, InputFormat(file)), batch, err)
+}
+
+// VerifyStream verifies an NDJSON stream event by event and writes a JSON line
+// for every event with -o jsonl or the findings of every invalid event as the
+// same text Report would. It returns the codes of all findings and the number
+// of events, or the error of ctx if it was done before the end of the stream
+// or an error counting the events that could not be parsed.
+func VerifyStream(ctx context.Context, r io.Reader, w io.Writer, useNumber bool) ([]string, int, error) {
+	return VerifyScanned(ctx, ScanNDJSON, r, w, useNumber)
+}
+
+// VerifyScanned is VerifyStream for the events that scan finds in r.
+func VerifyScanned(ctx context.Context, scan func(io.Reader, bool, func(int, map[string]interface{}, []string, error)) error, r io.Reader, w io.Writer, useNumber bool) ([]string, int, error) {
+	var codes []string
+	n, malformed := 0, 0
+
+	window := NewIDWindow(IDWindowSize)
+	err := scan(r, useNumber, func(i int, j map[string]interface{}, order []string, err error) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		n++
+		if err != nil {
+			// reported as a failing event so that the rest are still verified
+			malformed++
+			if Output == "jsonl" {
+				WriteJSONLine(w, LineResult{Result: Result{Error: err.Error(), Findings: []Finding{}}})
+			} else {
+				fmt.Fprintf(w, "Event %d:\n%s\n", i, err)
+			}
+			return
+		}
+
+		findings := VerifyOrdered(ctx, j, order)
+		if f := window.Check(i, j); f != nil {
+			findings = append(findings, *f)
+		}
+		codes = FindingCodes(codes, findings)
+
+		if Output == "jsonl" {
+			WriteJSONLine(w, NewLineResult(j, findings))
+		} else {
+			WriteEventReport(w, i, NewLineResult(j, findings).Result, true)
+		}
+	})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil && malformed > 0 {
+		err = fmt.Errorf("%d of %d events could not be parsed", malformed, n)
+	}
+
+	return codes, n, err
+}
+
+// LineResult is the result of one event with -o jsonl, which names the event
+// since the lines are usually read without their input.
+type LineResult struct {
+	ID     string `json:"id,omitempty"`
+	Source string `json:"source,omitempty"`
+	Result
+}
+
+func NewLineResult(j map[string]interface{}, findings []Finding) LineResult {
+	r := NewResult(findings)
+	if ReportPassing {
+		r.Passed = PassedAttributes(j, findings)
+	}
+	return EventLineResult(j, r)
+}
+
+// EventLineResult names the result r of the event j.
+func EventLineResult(j map[string]interface{}, r Result) LineResult {
+	l := LineResult{Result: r}
+	l.ID, _ = j["id"].(string)
+	l.Source, _ = j["source"].(string)
+	return l
+}
+
+func WriteJSONLine(w io.Writer, v interface{}) {
+	bytes, _ := json.Marshal(v)
+	fmt.Fprintln(w, string(bytes))
+}
+
+// HandleSSE verifies the events of a Server-Sent Events stream read from stdin,
+// a file or an http or https URL.
+// StreamClient is the client of responses that are read as they arrive and
+// may last any time, so -read-timeout bounds connecting and waiting for the
+// headers rather than the whole response.
+func StreamClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: ReadTimeout}).DialContext,
+		TLSHandshakeTimeout:   ReadTimeout,
+		ResponseHeaderTimeout: ReadTimeout,
+	}}
+}
+
+// OpenSSE requests the Server-Sent Events stream at addr, the body of which
+// fails with ErrBodyTooLarge after -max-body-size bytes.
+func OpenSSE(addr string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := StreamClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s answered with %s", addr, res.Status)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{LimitBody(res.Body), res.Body}, nil
+}
+
+func HandleSSE(src string) int {
+	var r io.Reader = os.Stdin
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		body, err := OpenSSE(src)
+		if err != nil {
+			return Report(nil, nil, false, err)
+		}
+		defer body.Close()
+		r = body
+	} else if src != "-" {
+		f, err := os.Open(src)
+		if err != nil {
+			return Report(nil, nil, false, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	w := os.Stderr
+	if Output == "jsonl" {
+		w = os.Stdout
+	} else {
+		PrintPerformedChecks()
+	}
+
+	codes, n, err := VerifyScanned(context.Background(), ScanSSE, r, w, true)
+	if err == nil && n == 0 {
+		err = ErrNoSSEEvents
+	}
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+
+	if AssertInvalid {
+		fmt.Fprint(os.Stderr, AssertionSummary(codes))
+	}
+
+	return ExitStatus(len(codes) == 0)
+}
+
+// StreamFile verifies an NDJSON file event by event.
+func StreamFile(file string) int {
+	r := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return Report(nil, nil, false, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	w := os.Stderr
+	if Output == "jsonl" {
+		w = os.Stdout
+	} else {
+		PrintPerformedChecks()
+	}
+
+	codes, n, err := VerifyStream(context.Background(), r, w, true)
+	if err == nil && n == 0 && file == "-" {
+		err = ErrNoInput
+	}
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+
+	if AssertInvalid {
+		fmt.Fprint(os.Stderr, AssertionSummary(codes))
+	}
+
+	return ExitStatus(len(codes) == 0)
+}
+
+func HandleURL(addr string) int {
+	body, err := FetchURL(addr)
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+
+	events, batch, err := ParseInput(bytes.NewReader(body), InputFormat(addr), true)
+	return Report(events, InputOrders(body, InputFormat(addr)), batch, err)
+}
+
+// ResponseBuffer is an http.ResponseWriter that keeps the status, headers and
+// body of a response in memory.
+type ResponseBuffer struct {
+	Code   int
+	Body   bytes.Buffer
+	header http.Header
+}
+
+func NewResponseBuffer() *ResponseBuffer {
+	return &ResponseBuffer{Code: http.StatusOK, header: make(http.Header)}
+}
+
+func (b *ResponseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *ResponseBuffer) WriteHeader(code int) {
+	b.Code = code
+}
+
+func (b *ResponseBuffer) Write(p []byte) (int, error) {
+	return b.Body.Write(p)
+}
+
+// VerifyRequestDump reads the dump of an HTTP request, such as one captured
+// from a CloudEvents SDK, and answers it as the server would.
+func VerifyRequestDump(r io.Reader) (*ResponseBuffer, error) {
+	req, err := http.ReadRequest(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	if req.Method != "POST" {
+		return nil, fmt.Errorf("expected a POST request, not %s", req.Method)
+	}
+	if Output == "json" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	rr := NewResponseBuffer()
+	HandleServer(rr, req)
+	return rr, nil
+}
+
+func HandleRequestDump(file string) int {
+	r := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return Report(nil, nil, false, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	rr, err := VerifyRequestDump(r)
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+
+	if Output == "json" {
+		fmt.Println(rr.Body.String())
+	} else {
+		if rr.Code != http.StatusOK && rr.Code != http.StatusUnprocessableEntity {
+			fmt.Fprintf(os.Stderr, "%d %s: ", rr.Code, http.StatusText(rr.Code))
+		}
+		fmt.Fprint(os.Stderr, rr.Body.String())
+		if s := rr.Body.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+
+	return ExitStatus(rr.Code == http.StatusOK)
+}
+
+// FilePattern is the glob that the names of the files of a directory have to
+// match to be read, or for "" the InputExtensions.
+var FilePattern = ""
+
+// InputExtensions are those of the files that DetectFormat knows the format of.
+var InputExtensions = []string{".json", ".yaml", ".yml", ".ndjson", ".jsonl"}
+
+// DirectoryFiles lists the files below dir, including in its subdirectories,
+// whose names match FilePattern.
+func DirectoryFiles(dir string) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		ok := StringInSlice(strings.ToLower(filepath.Ext(info.Name())), InputExtensions)
+		if FilePattern != "" {
+			ok, err = filepath.Match(FilePattern, info.Name())
+		}
+		if ok {
+			files = append(files, path)
+		}
+		return err
+	})
+
+	return files, err
+}
+
+// HandleDirectory verifies each of the DirectoryFiles of dir on its own.
+func HandleDirectory(dir string) int {
+	files, err := DirectoryFiles(dir)
+	if err != nil {
+		return Report(nil, nil, false, err)
+	}
+
+	if Output == "text" {
+		PrintPerformedChecks()
+	}
+
+	results := make(map[string]interface{}, len(files))
+	failed := false
+
+	for _, f := range files {
+		body, err := ReadInput(f)
+		var events []map[string]interface{}
+		batch := false
+		if err == nil {
+			events, batch, err = ParseInput(bytes.NewReader(body), InputFormat(f), true)
+		}
+
+		if err != nil {
+			failed = true
+
+			result := NewResult(nil)
+			result.Valid = false
+			result.Error = err.Error()
+			results[f] = result
+
+			if Output == "jsonl" {
+				WriteJSONLine(os.Stdout, result)
+			} else if Output == "text" {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", f, err)
+			}
+			continue
+		}
+
+		result := NewBatchResult(context.Background(), events, InputOrders(body, InputFormat(f)))
+		failed = failed || ExitStatus(result.Valid) != 0
+
+		if batch {
+			results[f] = result
+		} else {
+			results[f] = result.Events[0]
+		}
+
+		if Output == "jsonl" {
+			for i, r := range result.Events {
+				WriteJSONLine(os.Stdout, EventLineResult(events[i], r))
+			}
+		} else if Output == "text" {
+			if !result.Valid {
+				fmt.Fprintf(os.Stderr, "%s:\n", f)
+				WriteReport(os.Stderr, result, batch)
+			}
+			if AssertInvalid {
+				fmt.Fprintf(os.Stderr, "%s: %s", f, AssertionSummary(ResultCodes(result)))
+			}
+		}
+	}
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(results, "", JSONIndent)
+		fmt.Println(string(bytes))
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// ReadEvents reads every event from file or, when file is a directory, from
+// each of its DirectoryFiles.
+func ReadEvents(file string) ([]map[string]interface{}, error) {
+	files := []string{file}
+
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		if files, err = DirectoryFiles(file); err != nil {
+			return nil, err
+		}
+	}
+
+	var events []map[string]interface{}
+
+	for _, f := range files {
+		body, err := ReadInput(f)
+		if err != nil {
+			return nil, err
+		}
+
+		e, _, err := ParseInput(bytes.NewReader(body), InputFormat(f), true)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f, err)
+		}
+		events = append(events, e...)
+	}
+
+	return events, nil
+}
+
+type AttributeStat struct {
+	Attribute string `json:"attribute"`
+	Extension bool   `json:"extension"`
+	Count     int    `json:"count"`
+}
+
+// AttributeStats counts the events each attribute appears in, most frequent
+// first.
+func AttributeStats(events []map[string]interface{}) []AttributeStat {
+	counts := make(map[string]int)
+
+	for _, j := range events {
+		for k := range j {
+			counts[k]++
+		}
+	}
+
+	var stats []AttributeStat
+	for k, n := range counts {
+		stats = append(stats, AttributeStat{k, !IsAttribute(k) && k != "data" && k != "data_base64", n})
+	}
+
+	sort.Slice(stats, func(a, b int) bool {
+		if stats[a].Count != stats[b].Count {
+			return stats[a].Count > stats[b].Count
+		}
+		return stats[a].Attribute < stats[b].Attribute
+	})
+
+	return stats
+}
+
+func HandleStats(file string) int {
+	events, err := ReadEvents(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	stats := AttributeStats(events)
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(stats, "", JSONIndent)
+		fmt.Println(string(bytes))
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ATTRIBUTE\tKIND\tEVENTS")
+	for _, s := range stats {
+		kind := "core"
+		if s.Extension {
+			kind = "extension"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\n", s.Attribute, kind, s.Count, len(events))
+	}
+	w.Flush()
+
+	return 0
+}
+
+// Project copies the given attributes of j that are set, the data redacted
+// with -redact.
+func Project(j map[string]interface{}, attributes []string) map[string]interface{} {
+	if Redact {
+		j = Redacted(j)
+	}
+
+	p := make(map[string]interface{}, len(attributes))
+	for _, k := range attributes {
+		if v, ok := j[k]; ok {
+			p[k] = v
+		}
+	}
+	return p
+}
+
+// WriteProjections writes the given attributes of each valid event as a JSON
+// line to w and reports each invalid event to log instead, returning how many
+// were skipped.
+func WriteProjections(events []map[string]interface{}, attributes []string, w io.Writer, log io.Writer) int {
+	skipped := 0
+
+	for i, j := range events {
+		if findings := Verify(j); len(findings) > 0 {
+			fmt.Fprintf(log, "Event %d skipped:\n%s", i, FormatFindings(findings))
+			skipped++
+			continue
+		}
+
+		WriteJSONLine(w, Project(j, attributes))
+	}
+
+	return skipped
+}
+
+func HandleOutputAttributes(file string, attributes []string) int {
+	events, err := ReadEvents(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return ExitStatus(WriteProjections(events, attributes, os.Stdout, os.Stderr) == 0)
+}
+
+// GroupAttributes are the attributes -group-by can group events by.
+var GroupAttributes = []string{"type", "source"}
+
+type GroupCount struct {
+	Group   string `json:"group"`
+	Valid   int    `json:"valid"`
+	Invalid int    `json:"invalid"`
+}
+
+// GroupCounts tallies how many events of each value of the attribute by are
+// valid, sorted by value; events without a string value are grouped under "".
+func GroupCounts(events []map[string]interface{}, result BatchResult, by string) []GroupCount {
+	index := make(map[string]int)
+	var groups []GroupCount
+
+	for i, j := range events {
+		g, _ := j[by].(string)
+		n, ok := index[g]
+		if !ok {
+			n = len(groups)
+			index[g] = n
+			groups = append(groups, GroupCount{Group: g})
+		}
+
+		if result.Events[i].Valid {
+			groups[n].Valid++
+		} else {
+			groups[n].Invalid++
+		}
+	}
+
+	sort.Slice(groups, func(a, b int) bool { return groups[a].Group < groups[b].Group })
+
+	return groups
+}
+
+func HandleGroupBy(file string, by string) int {
+	events, err := ReadEvents(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	result := NewBatchResult(context.Background(), events, nil)
+	groups := GroupCounts(events, result, by)
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(groups, "", JSONIndent)
+		fmt.Println(string(bytes))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(by)+"\tVALID\tINVALID")
+		for _, g := range groups {
+			name := g.Group
+			if name == "" {
+				name = "(none)"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\n", name, g.Valid, g.Invalid)
+		}
+		w.Flush()
+	}
+
+	return ExitStatus(result.Valid)
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+	raw    string
+}
+
+type yamlParser struct {
+	lines     []yamlLine
+	pos       int
+	useNumber bool
+}
+
+// ParseYAML decodes the subset of YAML that is needed to write events by
+// hand: block mappings and sequences, plain and quoted scalars, literal and
+// folded block scalars, and JSON-style flow collections. Anything outside of
+// it that would otherwise be read differently from a YAML parser, such as an
+// anchor, a tag or a second document, is an error.
+func ParseYAML(body []byte, useNumber bool) (interface{}, error) {
+	p := &yamlParser{useNumber: useNumber}
+	started := false
+
+	for i, raw := range strings.Split(strings.Replace(string(body), "\r\n", "\n", -1), "\n") {
+		text := strings.TrimRight(StripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("YAML line %d is indented with a tab", i+1)
+		}
+
+		// directives and the start of the document may only come first
+		if (trimmed == "---" || strings.HasPrefix(trimmed, "%")) && !started {
+			continue
+		}
+		if trimmed == "---" || trimmed == "..." || strings.HasPrefix(trimmed, "--- ") || strings.HasPrefix(trimmed, "... ") {
+			return nil, fmt.Errorf("YAML line %d has an unsupported document marker (only a single document is supported)", i+1)
+		}
+
+		p.lines = append(p.lines, yamlLine{i + 1, len(text) - len(trimmed), trimmed, raw})
+		started = started || trimmed != ""
+	}
+
+	p.skipBlank()
+	if p.pos == len(p.lines) {
+		return nil, errors.New("YAML document is empty")
+	}
+
+	v, err := p.parseBlock(p.lines[p.pos].indent, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.skipBlank(); p.pos < len(p.lines) {
+		return nil, fmt.Errorf("YAML line %d is not indented correctly", p.lines[p.pos].num)
+	}
+
+	return v, nil
+}
+
+func StripYAMLComment(line string) string {
+	quote := byte(0)
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+}
+
+func (p *yamlParser) parseBlock(indent int, depth int) (interface{}, error) {
+	if MaxDepth > 0 && depth > MaxDepth {
+		return nil, fmt.Errorf("YAML is nested too deeply (more than %d levels)", MaxDepth)
+	}
+
+	line := p.lines[p.pos]
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.parseSequence(indent, depth)
+	}
+	if _, _, ok := SplitYAMLKey(line.text); ok {
+		return p.parseMapping(indent, depth)
+	}
+
+	p.pos++
+	return p.parseScalar(line.text, line.num)
+}
+
+func (p *yamlParser) parseSequence(indent int, depth int) (interface{}, error) {
+	a := []interface{}{}
+
+	for p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent == indent; p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			break
+		}
+
+		var v interface{}
+		var err error
+
+		if rest := strings.TrimLeft(line.text[1:], " "); rest == "" {
+			p.pos++
+			v, err = p.parseNested(indent, depth)
+		} else {
+			// an entry on the same line as the dash is parsed as if it
+			// started a block of its own at the column it is written at
+			p.lines[p.pos] = yamlLine{line.num, indent + len(line.text) - len(rest), rest, line.raw}
+			v, err = p.parseBlock(p.lines[p.pos].indent, depth+1)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		a = append(a, v)
+	}
+
+	return a, nil
+}
+
+func (p *yamlParser) parseMapping(indent int, depth int) (interface{}, error) {
+	m := make(map[string]interface{})
+
+	for p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent == indent; p.skipBlank() {
+		line := p.lines[p.pos]
+
+		key, rest, ok := SplitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("YAML line %d is not a `key: value` pair", line.num)
+		}
+
+		if k, err := p.parseScalar(key, line.num); err != nil {
+			return nil, err
+		} else if key = fmt.Sprint(k); k == nil {
+			key = "null"
+		}
+
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("YAML line %d repeats the key %q", line.num, key)
+		}
+
+		var v interface{}
+		var err error
+		p.pos++
+
+		switch {
+		case rest == "":
+			if p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent == indent && strings.HasPrefix(p.lines[p.pos].text+" ", "- ") {
+				// a sequence may be written at the same indentation as its key
+				v, err = p.parseSequence(indent, depth+1)
+			} else {
+				v, err = p.parseNested(indent, depth)
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			if len(rest) > 2 || (len(rest) == 2 && rest[1] != '-') {
+				return nil, fmt.Errorf("YAML line %d has an unsupported block scalar header %q (only |, |-, > and >- are supported)", line.num, rest)
+			}
+			v = p.parseBlockScalar(indent, rest)
+		default:
+			v, err = p.parseScalar(rest, line.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		m[key] = v
+	}
+
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, fmt.Errorf("YAML line %d is not indented correctly", p.lines[p.pos].num)
+	}
+
+	return m, nil
+}
+
+func (p *yamlParser) parseNested(indent int, depth int) (interface{}, error) {
+	if p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return p.parseBlock(p.lines[p.pos].indent, depth+1)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) parseBlockScalar(indent int, header string) string {
+	var lines []string
+	block := -1
+
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := strings.TrimRight(p.lines[p.pos].raw, " \t\r")
+		trimmed := strings.TrimLeft(raw, " ")
+
+		if trimmed == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if n := len(raw) - len(trimmed); n <= indent {
+			break
+		} else if block == -1 {
+			block = n
+		}
+
+		if len(raw) < block {
+			raw = strings.Repeat(" ", block)
+		}
+		lines = append(lines, raw[block:])
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	s := strings.Join(lines, "\n")
+	if header[0] == '>' {
+		// folding turns single line breaks into spaces and drops the line
+		// break before each run of empty lines
+		s = ""
+		for i, line := range lines {
+			if i > 0 && line != "" && lines[i-1] != "" {
+				s += " "
+			} else if i > 0 && line == "" {
+				s += "\n"
+			}
+			s += line
+		}
+	}
+	if !strings.Contains(header, "-") && s != "" {
+		s += "\n"
+	}
+
+	return s
+}
+
+func (p *yamlParser) parseScalar(s string, num int) (interface{}, error) {
+	switch {
+	case s[0] == '"':
+		// Go and YAML share the escapes but for \' and octal ones, which
+		// only Go has
+		if YAMLOnlyGoEscape.MatchString(s) {
+			return nil, fmt.Errorf("YAML line %d has an unsupported escape in a double-quoted string", num)
+		}
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("YAML line %d has a malformed double-quoted string", num)
+		}
+		return v, nil
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' || strings.Contains(strings.Replace(s[1:len(s)-1], "''", "", -1), "'") {
+			return nil, fmt.Errorf("YAML line %d has a malformed single-quoted string", num)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case s[0] == '{' || s[0] == '[':
+		var v interface{}
+		decoder := json.NewDecoder(strings.NewReader(s))
+		if p.useNumber {
+			decoder.UseNumber()
+		}
+		if err := decoder.Decode(&v); err != nil {
+			return nil, fmt.Errorf("YAML line %d has an unsupported flow collection (only JSON syntax is supported)", num)
+		}
+		return v, nil
+	case s == "~" || s == "null" || s == "Null" || s == "NULL":
+		return nil, nil
+	case s == "true" || s == "True" || s == "TRUE":
+		return true, nil
+	case s == "false" || s == "False" || s == "FALSE":
+		return false, nil
+	case regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`).MatchString(s):
+		if p.useNumber {
+			return json.Number(strings.TrimPrefix(s, "+")), nil
+		}
+		return strconv.ParseFloat(s, 64)
+	case strings.ContainsRune("&*!|>%@`?,]}", rune(s[0])):
+		return nil, fmt.Errorf("YAML line %d has an unsupported plain scalar %q (anchors, aliases, tags and other indicators are not supported)", num, s)
+	case strings.Contains(s, ": ") || strings.HasSuffix(s, ":"):
+		return nil, fmt.Errorf("YAML line %d has a mapping where a plain scalar is expected", num)
+	case YAMLOtherNumber.MatchString(s):
+		return nil, fmt.Errorf("YAML line %d has an unsupported number %q (only decimal numbers are supported)", num, s)
+	}
+
+	return s, nil
+}
+
+// YAMLOnlyGoEscape matches an escape that strconv.Unquote accepts in a
+// double-quoted string but YAML does not: \' or an octal one.
+var YAMLOnlyGoEscape = regexp.MustCompile(`^"(?:[^\\]|\\[^'0-7])*\\['0-7]`)
+
+// YAMLOtherNumber matches the numbers of YAML that are not written in decimal.
+var YAMLOtherNumber = regexp.MustCompile(`^(?:[-+]?(?:0x[0-9a-fA-F]+|0o[0-7]+|\.(?:inf|Inf|INF))|\.(?:nan|NaN|NAN))$`)
+
+// SplitYAMLKey splits a `key: value` line on the first colon that is outside
+// of quotes and followed by a space or the end of the line.
+func SplitYAMLKey(line string) (string, string, bool) {
+	if line[0] == '{' || line[0] == '[' {
+		return "", "", false
+	}
+
+	quote := byte(0)
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i+1 == len(line) || line[i+1] == ' '):
+			if i == 0 {
+				return "", "", false
+			}
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// WatchFile verifies file and then verifies it again every time its size or
+// modification time changes, writing each result to w until stop is closed.
+func WatchFile(file string, interval time.Duration, w io.Writer, stop <-chan struct{}) {
+	var last os.FileInfo
+
+	for {
+		info, err := os.Stat(file)
+		if err != nil {
+			if last != nil {
+				fmt.Fprintln(w, err)
+			}
+			last = nil
+		} else if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+
+			if findings, err := VerifyFile(file); err != nil {
+				fmt.Fprintf(w, "%s: %s\n", file, err)
+			} else if len(findings) > 0 {
+				fmt.Fprintf(w, "%s:\n%s", file, FormatFindings(findings))
+			} else {
+				fmt.Fprintf(w, "%s: valid\n", file)
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+type HeaderMapping struct {
+	Header    string `json:"header"`
+	Attribute string `json:"attribute"`
+	Value     string `json:"value"`
+}
+
+func MapHeaders(h http.Header) []HeaderMapping {
+	var mappings []HeaderMapping
+
+	for k := range h {
+		if strings.HasPrefix(strings.ToLower(k), "ce-") {
+			mappings = append(mappings, HeaderMapping{Header: k, Attribute: strings.ToLower(k[3:]), Value: h[k][0]})
+		}
+	}
+
+	sort.Slice(mappings, func(a, b int) bool { return mappings[a].Header < mappings[b].Header })
+
+	return mappings
+}
+
+func HeaderAttributes(h http.Header) (map[string]interface{}, []Finding) {
+	j := make(map[string]interface{})
+	var findings []Finding
+
+	// header names are case-insensitive, so two headers differing only in
+	// case either arrive as one header with several values or, when the map
+	// was not canonicalized, as two headers for the same attribute
+	seen := make(map[string]string)
+
+	for _, m := range MapHeaders(h) {
+		if len(m.Attribute) == 0 {
+			findings = append(findings, *NewFinding(BadHeader, "", "Bad CloudEvent header."))
+			continue
+		}
+
+		if n := len(h[m.Header]); n > 1 {
+			findings = append(findings, *NewFinding(DuplicateAttribute, m.Attribute, "HTTP header `"+m.Header+"` is given "+strconv.Itoa(n)+" times (header names are case-insensitive)"))
+		}
+
+		if other, ok := seen[m.Attribute]; ok {
+			findings = append(findings, *NewFinding(DuplicateAttribute, m.Attribute, "HTTP headers `"+other+"` and `"+m.Header+"` both map to attribute `"+m.Attribute+"` (header names are case-insensitive)"))
+		} else {
+			seen[m.Attribute] = m.Header
+			j[m.Attribute] = m.Value
+		}
+	}
+
+	return j, findings
+}
+
+const (
+	FromHeader      = "`ce-` header"
+	FromContentType = "`Content-Type` header"
+	FromBody        = "body"
+)
+
+// BinaryAttributes rebuilds a binary mode event and records where each of its
+// attributes came from.
+func BinaryAttributes(h http.Header, body []byte) (map[string]interface{}, map[string]string, []Finding) {
+	j, findings := HeaderAttributes(h)
+
+	provenance := make(map[string]string, len(j)+2)
+	for k := range j {
+		provenance[k] = FromHeader
+	}
+
+	for _, e := range [][2]string{{"datacontenttype", FromContentType}, {"data", FromBody}} {
+		if provenance[e[0]] == FromHeader {
+			findings = append(findings, *NewFinding(WrongProvenance, e[0], "HTTP header `ce-"+e[0]+"` is not allowed in binary mode (`"+e[0]+"` is carried by the "+e[1]+")"))
+		}
+	}
+
+	// without a body there is no data for Content-Type to describe
+	if len(body) > 0 {
+		if t := h.Get("Content-Type"); t != "" {
+			j["datacontenttype"] = strings.ToLower(t)
+			provenance["datacontenttype"] = FromContentType
+		}
+
+		// kept as bytes so that a payload that is not UTF-8 survives intact
+		j["data"] = body
+		provenance["data"] = FromBody
+	}
+
+	return j, provenance, findings
+}
+
+// MergeAttributes combines the attributes of ce- headers with those of a
+// structured event the way a transcoding gateway would; header values take
+// precedence and any that differ from the body are reported.
+func MergeAttributes(h http.Header, body map[string]interface{}) (map[string]interface{}, []Finding) {
+	attributes, findings := HeaderAttributes(h)
+
+	j := make(map[string]interface{}, len(body)+len(attributes))
+	for k, v := range body {
+		j[k] = v
+	}
+
+	for _, m := range MapHeaders(h) {
+		v, ok := attributes[m.Attribute]
+		if !ok {
+			continue
+		}
+
+		if b, ok := body[m.Attribute]; ok && fmt.Sprint(b) != v {
+			findings = append(findings, *NewFinding(ConflictingAttribute, m.Attribute, "HTTP header `"+m.Header+"` is "+strconv.Quote(v.(string))+" but attribute `"+m.Attribute+"` of the body is "+strconv.Quote(fmt.Sprint(b))))
+		}
+		j[m.Attribute] = v
+	}
+
+	return j, findings
+}
+
+// ReadHeaders reads HTTP headers, one "Name: value" per line.
+func ReadHeaders(file string) (http.Header, error) {
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	body = append(bytes.TrimLeft(body, "\r\n"), "\n\n"...)
+
+	h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(body))).ReadMIMEHeader()
+	return http.Header(h), err
+}
+
+func HandleMerge(headers string, file string) int {
+	h, err := ReadHeaders(headers)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	body, _, err := ReadEvent(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	j, findings := MergeAttributes(h, body)
+	result := NewResult(append(findings, Verify(j)...))
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(result, "", JSONIndent)
+		fmt.Println(string(bytes))
+	} else {
+		fmt.Fprint(os.Stderr, FormatFindings(result.Findings))
+		if AssertInvalid {
+			fmt.Fprint(os.Stderr, AssertionSummary(result.codes))
+		}
+	}
+
+	return ExitStatus(result.Valid)
+}
+
+// VerifyRemote verifies j with the CEVerify server at addr, posting it in
+// structured mode.
+func VerifyRemote(addr string, j map[string]interface{}) ([]Finding, error) {
+	body, err := json.Marshal(StructuredEvent(j))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", addr, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, b, err := Fetch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Result
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("%s returned %s without a JSON result", addr, resp.Status)
+	} else if result.Error != "" {
+		return nil, fmt.Errorf("%s returned an error: %s", addr, result.Error)
+	}
+
+	return result.Findings, nil
+}
+
+// Comparison is how the local findings of an event differ from a server's,
+// matching findings by code and attribute since messages change between
+// versions.
+type Comparison struct {
+	Agree  bool      `json:"agree"`
+	Local  []Finding `json:"local"`
+	Remote []Finding `json:"remote"`
+}
+
+func CompareFindings(local []Finding, remote []Finding) Comparison {
+	only := func(a []Finding, b []Finding) []Finding {
+		seen := make(map[[2]string]bool, len(b))
+		for _, f := range b {
+			seen[[2]string{f.Code, f.Attribute}] = true
+		}
+
+		r := []Finding{}
+		for _, f := range a {
+			if !seen[[2]string{f.Code, f.Attribute}] {
+				r = append(r, f)
+			}
+		}
+		return r
+	}
+
+	c := Comparison{Local: only(local, remote), Remote: only(remote, local)}
+	c.Agree = len(c.Local) == 0 && len(c.Remote) == 0
+	return c
+}
+
+func HandleCompare(addr string, file string) int {
+	j, _, err := ReadEvent(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	local := Verify(j)
+	remote, err := VerifyRemote(addr, j)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	c := CompareFindings(local, remote)
+
+	if Output == "json" {
+		bytes, _ := json.MarshalIndent(c, "", JSONIndent)
+		fmt.Println(string(bytes))
+	} else if c.Agree {
+		fmt.Fprintf(os.Stderr, "%s agrees (%d findings)\n", addr, len(local))
+	} else {
+		if len(c.Local) > 0 {
+			fmt.Fprintf(os.Stderr, "Only found locally:\n%s", FormatFindings(c.Local))
+		}
+		if len(c.Remote) > 0 {
+			fmt.Fprintf(os.Stderr, "Only found by %s:\n%s", addr, FormatFindings(c.Remote))
+		}
+	}
+
+	return ExitStatus(c.Agree)
+}
+
+// StructuredContentTypes are the prefixes of the Content-Type of a structured
+// mode request.
+var StructuredContentTypes = []string{"application/cloudevents"}
+
+func IsStructured(t string) bool {
+	for _, p := range StructuredContentTypes {
+		if strings.HasPrefix(t, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func HasHeaderAttributes(h http.Header) bool {
+	return CountHeaderAttributes(h) > 0
+}
+
+// CountHeaderAttributes counts the values of ce- headers, each of which
+// becomes an attribute or a finding.
+func CountHeaderAttributes(h http.Header) int {
+	n := 0
+	for k, v := range h {
+		if strings.HasPrefix(strings.ToLower(k), "ce-") {
+			n += len(v)
+		}
+	}
+	return n
+}
+
+// MergeTrailers adds the ce- trailers of a request to its headers, for
+// producers that only know some attributes once they have streamed the body.
+// A trailer that differs from a header of the same name is reported and the
+// header kept.
+func MergeTrailers(h http.Header, trailer http.Header) (http.Header, []Finding) {
+	merged := h.Clone()
+	var findings []Finding
+
+	keys := make([]string, 0, len(trailer))
+	for k := range trailer {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := trailer[k]
+		if !strings.HasPrefix(strings.ToLower(k), "ce-") || len(v) == 0 {
+			continue
+		}
+
+		if old := merged.Get(k); old == "" {
+			merged[k] = v
+		} else if old != v[0] {
+			findings = append(findings, *NewFinding(ConflictingAttribute, strings.ToLower(k[3:]), "HTTP trailer `"+k+"` is "+strconv.Quote(v[0])+" but header `"+k+"` is "+strconv.Quote(old)))
+		}
+	}
+
+	return merged, findings
+}
+
+var AttributeWordPattern = regexp.MustCompile(`(?i)attribute`)
+
+// VerifyHeaders verifies the attributes j of the headers h, naming each
+// attribute by the header it came from. The server only has the names in the
+// canonical form of net/http, e.g. Ce-Some_typo, not as the client wrote them.
+func VerifyHeaders(ctx context.Context, j map[string]interface{}, h http.Header) []Finding {
+	j = TypedHeaderValues(j)
+
+	names := make(map[string]string)
+	for _, m := range MapHeaders(h) {
+		names[m.Attribute] = m.Header
+	}
+
+	var findings []Finding
+
+	for _, f := range VerifyOrdered(ctx, j, nil) {
+		// every header value is a string, so quoting is not a mistake here
+		if f.Code != SuspiciousString {
+			if name, ok := names[f.Attribute]; ok {
+				f.Message = strings.Replace(f.Message, "Attribute `"+f.Attribute+"`", "HTTP header `"+name+"`", 1)
+			}
+			f.Message = AttributeWordPattern.ReplaceAllString(f.Message, "HTTP header")
+			findings = append(findings, f)
+		}
+	}
+
+	return findings
+}
+
+// TypedHeaderValues copies j with the string values of the extensions that the
+// rules declare Boolean or Integer converted to them where they can be, since
+// binary mode carries every attribute as a string.
+func TypedHeaderValues(j map[string]interface{}) map[string]interface{} {
+	typed := make(map[string]interface{}, len(j))
+	for k, v := range j {
+		s, ok := v.(string)
+		switch {
+		case !ok || IsAttribute(k):
+		case LoadedRules.Extensions[k] == "Boolean" && (s == "true" || s == "false"):
+			v = s == "true"
+		case LoadedRules.Extensions[k] == "Integer" && IntegerPattern.MatchString(s):
+			v = json.Number(s)
+		}
+		typed[k] = v
+	}
+	return typed
+}
+
+func WantsJSON(r *http.Request) bool {
+	return strings.Contains(strings.ToLower(r.Header.Get("Accept")), "application/json")
+}
+
+// WriteResult sets the Content-Type of the response so that clients need not
+// rely on it being sniffed from the body.
+func WriteResult(w http.ResponseWriter, r *http.Request, status int, result Result) {
+	if WantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(status)
+
+	if WantsJSON(r) {
+		bytes, _ := json.Marshal(result)
+		w.Write(bytes)
+	} else if result.Error != "" {
+		w.Write([]byte(result.Error))
+	} else {
+		w.Write([]byte(FormatFindings(result.Findings)))
+	}
+}
+
+// EchoedAttributes copies the attributes of an event without its data, which
+// may be sensitive.
+func EchoedAttributes(j map[string]interface{}) map[string]interface{} {
+	if Redact {
+		return Redacted(j)
+	}
+
+	attributes := make(map[string]interface{}, len(j))
+	for k, v := range j {
+		if !IsData(k) {
+			attributes[k] = v
+		}
+	}
+	return attributes
+}
+
+func WriteFindings(w http.ResponseWriter, r *http.Request, j map[string]interface{}, findings []Finding) {
+	result := NewResult(findings)
+	if ReportPassing {
+		result.Passed = PassedAttributes(j, findings)
+	}
+	if EchoAttributes {
+		result.Attributes = EchoedAttributes(j)
+	}
+
+	// unlike a request that cannot be parsed (400), the event is well-formed
+	if len(findings) > 0 {
+		WriteResult(w, r, http.StatusUnprocessableEntity, result)
+	} else {
+		WriteResult(w, r, http.StatusOK, result)
+	}
+}
+
+func WriteError(w http.ResponseWriter, r *http.Request, status int, err string) {
+	result := NewResult(nil)
+	result.Valid = false
+	result.Error = err
+
+	WriteResult(w, r, status, result)
+}
+
+const HomePage = `<body style="font-family: Segoe UI"><h1>CloudEvents Verify</h1>
+
+A tool to help verify CloudEvents according to the <a href="https://github.com/cloudevents/spec/blob/master/spec.md">specifications</a>.
+
+<h2>Usage</h2>
+
+If no value is returned, the CloudEvent is correct. Otherwise, an error will be returned.
+<br>
+- To see how to send proper requests to this server, see the <a href="https://github.com/cloudevents/spec/blob/master/http-transport-binding.md">HTTP Transport Binding for CloudEvents</a>.
+
+<div style="position: absolute; top: 0; right: 5px;"><a href="https://github.com/btbd/CEVerify">source</a></div></body>`
+
+func HandleServer(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if r.Method == "POST" {
+		if n := CountHeaderAttributes(r.Header); MaxHeaders > 0 && n > MaxHeaders {
+			WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("too many ce- headers (%d, maximum is %d)", n, MaxHeaders))
+			return
+		}
+
+		t := strings.ToLower(r.Header.Get("Content-Type"))
+		body, err := ReadLimited(r.Body)
+		if err == ErrBodyTooLarge {
+			WriteError(w, r, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		} else if err != nil {
+			WriteError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// the trailers are only known once the body has been read
+		h := r.Header
+		var merged []Finding
+		if ReadTrailers {
+			h, merged = MergeTrailers(r.Header, r.Trailer)
+			if n := CountHeaderAttributes(h); MaxHeaders > 0 && n > MaxHeaders {
+				WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("too many ce- headers and trailers (%d, maximum is %d)", n, MaxHeaders))
+				return
+			}
+		}
+
+		if len(body) == 0 && !IsStructured(t) && HasHeaderAttributes(h) {
+			// header-only mode: there is no payload, so only the context
+			// attributes carried in `ce-` headers are validated and the
+			// event has neither data nor a datacontenttype
+			j, _, findings := BinaryAttributes(h, nil)
+			findings = append(append(merged, findings...), VerifyHeaders(r.Context(), j, h)...)
+
+			WriteFindings(w, r, j, findings)
+		} else if t != "" {
+			j := make(map[string]interface{})
+			var findings []Finding
+
+			if IsStructured(t) {
+				// structured mode, where only the JSON format of CloudEvents is
+				// supported and the other -structured-content-types are JSON
+				if m, _, err := mime.ParseMediaType(t); err != nil || (strings.HasPrefix(m, "application/cloudevents") && !strings.HasSuffix(m, "+json")) {
+					WriteResult(w, r, http.StatusUnsupportedMediaType, NewResult([]Finding{*NewFinding(UnsupportedFormat, "", "The structured mode header 'Content-Type' must have the '+json' suffix (is currently "+strconv.Quote(t)+")")}))
+					return
+				}
+
+				err := CheckDepth(body)
+				if err == nil && StrictJSON {
+					err = CheckStrictJSON(body)
+				}
+				if err == nil {
+					err = UnmarshalNumbers(body, &j)
+				}
+				if err != nil {
+					WriteError(w, r, http.StatusBadRequest, err.Error())
+					return
+				}
+
+				findings = VerifyOrdered(r.Context(), j, EventOrder(body, ""))
+			} else {
+				// binary mode
+				j, _, findings = BinaryAttributes(h, body)
+				findings = append(append(merged, findings...), VerifyHeaders(r.Context(), j, h)...)
+			}
+
+			WriteFindings(w, r, j, findings)
+		} else {
+			WriteResult(w, r, http.StatusBadRequest, NewResult([]Finding{*NewFinding(MissingContentType, "", "The header 'Content-Type' must be defined")}))
+		}
+	} else {
+		// A HEAD request gets the headers of the page without the page itself.
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(HomePage)))
+		if r.Method != "HEAD" {
+			w.Write([]byte(HomePage))
+		}
+	}
+}
+
+func HandleDebugHeaders(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	mappings := MapHeaders(r.Header)
+	if mappings == nil {
+		mappings = []HeaderMapping{}
+	}
+
+	if t := r.Header.Get("Content-Type"); t != "" && !IsStructured(strings.ToLower(t)) {
+		mappings = append(mappings, HeaderMapping{Header: "Content-Type", Attribute: "datacontenttype", Value: strings.ToLower(t)})
+	}
+
+	bytes, _ := json.MarshalIndent(mappings, "", JSONIndent)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
+
+// CheckTLS refuses to serve plain HTTP when -require-tls is set.
+func CheckTLS(crt string, key string) error {
+	if RequireTLS && (len(crt) == 0 || len(key) == 0) {
+		return ErrTLSRequired
+	}
+	return nil
+}
+
+// CORSOrigins are the origins of browser-based tools that may call the
+// server, "*" for any; CORS is disabled while there are none.
+var CORSOrigins []string
+
+// CORS lets the origins of -cors-origins call next and answers their
+// preflight requests itself. Any other OPTIONS request is left to next.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !(StringInSlice("*", CORSOrigins) || StringInSlice(origin, CORSOrigins)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+
+		if r.Method != "OPTIONS" || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// events carry their attributes in ce- headers of any name, so every
+		// requested header is allowed
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, OPTIONS")
+		if h := r.Header.Get("Access-Control-Request-Headers"); h != "" {
+			w.Header().Set("Access-Control-Allow-Headers", h)
+		}
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func NewServer(port int) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", HandleServer)
+
+	if Debug {
+		mux.HandleFunc("/debug/headers", HandleDebugHeaders)
+	}
+
+	var handler http.Handler = mux
+	if len(CORSOrigins) > 0 {
+		handler = CORS(mux)
+	}
+
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(port),
+		Handler:           handler,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ReadTimeout:       ReadTimeout,
+		WriteTimeout:      WriteTimeout,
+	}
+}
+
+func main() {
+	file := ""
+	port := 80
+	crt := ""
+	key := ""
+	watch := false
+	fix := false
+	listChecks := false
+	stats := false
+	pipe := false
+	requestDump := ""
+	jsonPointerErrors := false
+	sse := ""
+	versions := ""
+	sinceSpecVersion := false
+	verifyFixtures := false
+	merge := ""
+	compare := false
+	sampleInvalid := ""
+	genVectors := ""
+	groupBy := ""
+	outputAttributes := ""
+	remote := ""
+	subjectPattern := ""
+	rules := ""
+	jsonIndent := "2"
+	locale := "en"
+	envelopeSchema := ""
+	registry := ""
+	structured := strings.Join(StructuredContentTypes, ",")
+	corsOrigins := ""
+
+	usage := flag.Usage
+	flag.Usage = func() {
+		fmt.Println("CloudEvents specification checker")
+		usage()
+	}
+
+	flag.StringVar(&file, "f", file, "file")
+	flag.StringVar(&remote, "url", remote, "URL to fetch an event or batch from, or of the server of -compare-to-server")
+	flag.IntVar(&port, "p", port, "port")
+	flag.StringVar(&crt, "crt", crt, "certificate for TLS")
+	flag.StringVar(&key, "key", key, "key for TLS")
+	flag.BoolVar(&RequireTLS, "require-tls", RequireTLS, "refuse to start the server without -crt and -key")
+	flag.StringVar(&Format, "input-format", Format, "input format (auto, json, yaml or ndjson)")
+	flag.StringVar(&FilePattern, "pattern", FilePattern, "glob that the names of the files of a directory given with -f must match (default every .json, .yaml, .yml, .ndjson and .jsonl file)")
+	flag.StringVar(&JSONPointer, "json-pointer", JSONPointer, "JSON pointer to the event within the file")
+	flag.BoolVar(&jsonPointerErrors, "json-pointer-errors", jsonPointerErrors, "report the findings of the structured JSON events of the file with the JSON pointer and byte offsets of their attribute")
+	flag.BoolVar(&Redact, "redact", Redact, "replace data with its size in every printed or echoed event and in findings")
+	flag.BoolVar(&EchoAttributes, "echo-attributes", EchoAttributes, "include the verified attributes (without data) in JSON responses")
+	flag.BoolVar(&ReadTrailers, "trailer", ReadTrailers, "also read the attributes of binary mode requests from ce- trailers")
+	flag.BoolVar(&Debug, "debug", Debug, "enable the server's debug routes")
+	flag.StringVar(&corsOrigins, "cors-origins", corsOrigins, "comma-separated origins (or *) allowed to call the server from a browser")
+	flag.StringVar(&structured, "structured-content-types", structured, "comma-separated Content-Type prefixes of structured mode requests")
+	flag.StringVar(&envelopeSchema, "envelope-schema", envelopeSchema, "JSON Schema file (or \"bundled\") to validate every whole event against")
+	flag.StringVar(&SchemaDraft, "schema-draft", SchemaDraft, "JSON Schema draft of -envelope-schema ("+strings.Join(SchemaDrafts, " or ")+")")
+	flag.StringVar(&registry, "registry-url", registry, "URL of a registry of the allowed event types and the schemas of their data")
+	flag.StringVar(&rules, "rules", rules, "rules file")
+	flag.StringVar(&Only, "only", Only, "only run the checks of the given attribute")
+	flag.BoolVar(&Verbose, "v", Verbose, "list the checks that are performed")
+	flag.BoolVar(&AssertInvalid, "assert-invalid", AssertInvalid, "succeed only if the input is invalid")
+	flag.BoolVar(&ReportPassing, "report-passing", ReportPassing, "also list the attributes that passed every check")
+	flag.BoolVar(&Strict, "strict", Strict, "enable stricter checks that are not required by the specification")
+	flag.StringVar(&Output, "o", Output, "output format (text, json or jsonl)")
+	flag.StringVar(&locale, "locale", locale, "language of finding messages ("+strings.Join(KnownLocales(), " or ")+")")
+	flag.BoolVar(&ValidateXMLData, "validate-xml-data", ValidateXMLData, "check that data is well-formed XML when datacontenttype is XML")
+	flag.BoolVar(&CanonicalOrder, "canonical-order", CanonicalOrder, "report members of JSON events that are not in the canonical order")
+	flag.BoolVar(&ExplainErrors, "explain-errors", ExplainErrors, "link each finding to the relevant part of the specification")
+	flag.BoolVar(&listChecks, "list-checks", listChecks, "list every check that can be performed")
+	flag.BoolVar(&verifyFixtures, "verify-fixtures", verifyFixtures, "verify the bundled example events and check each is as valid as expected")
+	flag.BoolVar(&sinceSpecVersion, "since-spec-version", sinceSpecVersion, "print the oldest specversion the event from the file is valid for")
+	flag.StringVar(&versions, "versions", versions, "verify the event from the file as each of the comma-separated specversions (or \"all\") and print which it is valid for")
+	flag.StringVar(&requestDump, "http-request", requestDump, "verify the dump of an HTTP request (headers and body) in the given file (- for stdin) as the server would")
+	flag.StringVar(&sse, "sse", sse, "verify the events of a Server-Sent Events stream from stdin (-), a file or an http(s) URL")
+	flag.BoolVar(&pipe, "pipe", pipe, "copy the valid events of NDJSON from stdin to stdout and report the others on stderr")
+	flag.StringVar(&genVectors, "gen-vectors", genVectors, "write valid and invalid test events for every attribute and the checks that need no flag but -strict to the given JSON file (- for stdout)")
+	flag.StringVar(&sampleInvalid, "sample-invalid", sampleInvalid, "print a sample event with the given defect ("+strings.Join(DefectNames(), ", ")+")")
+	flag.StringVar(&outputAttributes, "output-attributes", outputAttributes, "print the comma-separated attributes of each valid event of the file or directory as a JSON line")
+	flag.StringVar(&groupBy, "group-by", groupBy, "print how many events of the file or directory are valid for each value of the attribute ("+strings.Join(GroupAttributes, " or ")+")")
+	flag.BoolVar(&stats, "stats", stats, "print how many events of the file or directory each attribute appears in")
+	flag.StringVar(&merge, "merge", merge, "file of HTTP headers to merge into the event from the file before verifying it")
+	flag.BoolVar(&compare, "compare-to-server", compare, "verify the event from the file with the CEVerify server at -url as well, reporting where its findings differ")
+	flag.BoolVar(&fix, "fix", fix, "print the event from the file with automatic fixes applied")
+	flag.StringVar(&jsonIndent, "json-indent", jsonIndent, "indentation of JSON output, a number of spaces or \"tab\"")
+	flag.BoolVar(&CompactJSON, "compact-json", CompactJSON, "print events as compact instead of indented JSON")
+	flag.BoolVar(&watch, "watch", watch, "re-verify the file whenever it changes")
+	flag.DurationVar(&EventTimeout, "context-timeout", EventTimeout, "maximum time to verify one event (0 for unlimited)")
+	flag.DurationVar(&ReadHeaderTimeout, "read-header-timeout", ReadHeaderTimeout, "server timeout for reading request headers")
+	flag.DurationVar(&ReadTimeout, "read-timeout", ReadTimeout, "server timeout for reading a whole request")
+	flag.DurationVar(&WriteTimeout, "write-timeout", WriteTimeout, "server timeout for writing a response")
+	flag.StringVar(&subjectPattern, "subject-pattern", subjectPattern, "regular expression that subject must match")
+	flag.Int64Var(&MaxBodySize, "max-body-size", MaxBodySize, "maximum size in bytes of a request or fetched body (0 for unlimited)")
+	flag.IntVar(&MaxDataSize, "max-data-size", MaxDataSize, "maximum size in bytes of data or data_base64 (0 for unlimited)")
+	flag.IntVar(&IDWindowSize, "id-window", IDWindowSize, "report ids that a source reuses within this many events of a batch or NDJSON stream (0 to disable)")
+	flag.IntVar(&MaxFindings, "max-findings", MaxFindings, "maximum number of findings reported for an event (0 for unlimited)")
+	flag.IntVar(&MaxHeaders, "max-headers", MaxHeaders, "maximum number of ce- headers of a request (0 for unlimited)")
+	flag.BoolVar(&StrictJSON, "strict-json", StrictJSON, "reject JSON with invalid UTF-8, unpaired surrogates, duplicate keys or content after the value")
+	flag.IntVar(&MaxDepth, "max-depth", MaxDepth, "maximum JSON nesting depth (0 for unlimited)")
+	flag.IntVar(&SubjectDataSize, "subject-data-size", SubjectDataSize, "size in bytes of data above which subject is expected in strict mode (0 to disable)")
+	flag.IntVar(&MaxIDLength, "max-id-length", MaxIDLength, "maximum length of id in strict mode (0 for unlimited)")
+	flag.IntVar(&MaxSourceLength, "max-source-length", MaxSourceLength, "maximum length of source (0 for unlimited)")
+	flag.IntVar(&MaxSourceSubjectLength, "max-source-subject-length", MaxSourceSubjectLength, "maximum combined length of source and subject (0 for unlimited)")
 
 	flag.Parse()
 
-	if len(file) > 0 {
-		HandleFile(file)
+	if len(rules) > 0 {
+		var err error
+		if LoadedRules, err = LoadRules(rules); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading rules %s:\n\t%s\n", rules, err)
+			os.Exit(2)
+		}
+	}
+
+	StructuredContentTypes = nil
+	for _, t := range strings.Split(structured, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); len(t) > 0 {
+			StructuredContentTypes = append(StructuredContentTypes, t)
+		}
+	}
+
+	for _, o := range strings.Split(corsOrigins, ",") {
+		if o = strings.TrimSpace(o); len(o) > 0 {
+			CORSOrigins = append(CORSOrigins, o)
+		}
+	}
+
+	if indent, err := ParseIndent(jsonIndent); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid JSON indent:\n\t%s\n", err)
+		os.Exit(2)
+	} else {
+		JSONIndent = indent
+	}
+
+	if catalog, err := LoadLocale(locale); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading locale:\n\t%s\n", err)
+		os.Exit(2)
+	} else {
+		Catalog = catalog
+	}
+
+	if !StringInSlice(SchemaDraft, SchemaDrafts) {
+		fmt.Fprintf(os.Stderr, "Unsupported schema draft %q (supported are %s)\n", SchemaDraft, strings.Join(SchemaDrafts, ", "))
+		os.Exit(2)
+	}
+
+	if len(envelopeSchema) > 0 {
+		var err error
+		if EnvelopeSchema, err = LoadSchema(envelopeSchema); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading envelope schema %s:\n\t%s\n", envelopeSchema, err)
+			os.Exit(2)
+		}
+	}
+
+	if len(registry) > 0 {
+		var err error
+		if EventRegistry, err = LoadRegistry(registry); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading registry %s:\n\t%s\n", registry, err)
+			os.Exit(2)
+		}
+	}
+
+	if len(subjectPattern) > 0 {
+		var err error
+		if SubjectPattern, err = regexp.Compile(`^(?:` + subjectPattern + `)$`); err != nil {
+			fmt.Fprintf(os.Stderr, "Error compiling subject pattern:\n\t%s\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if _, err := filepath.Match(FilePattern, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid file pattern %q:\n\t%s\n", FilePattern, err)
+		os.Exit(2)
+	}
+
+	if !StringInSlice(Format, InputFormats) {
+		fmt.Fprintf(os.Stderr, "Unknown input format %q\n", Format)
+		os.Exit(2)
+	}
+
+	if Output != "text" && Output != "json" && Output != "jsonl" {
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", Output)
+		os.Exit(2)
+	}
+
+	if listChecks {
+		HandleListChecks()
+	} else if verifyFixtures {
+		os.Exit(HandleVerifyFixtures())
+	} else if watch {
+		if len(file) == 0 || file == "-" {
+			fmt.Fprintln(os.Stderr, "-watch requires a file given with -f")
+			os.Exit(2)
+		}
+
+		stop := make(chan struct{})
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		go func() {
+			<-c
+			close(stop)
+		}()
+
+		WatchFile(file, 500*time.Millisecond, os.Stdout, stop)
+	} else if len(genVectors) > 0 {
+		os.Exit(HandleGenVectors(genVectors))
+	} else if len(sampleInvalid) > 0 {
+		os.Exit(HandleSampleInvalid(sampleInvalid))
+	} else if len(requestDump) > 0 {
+		os.Exit(HandleRequestDump(requestDump))
+	} else if len(sse) > 0 {
+		os.Exit(HandleSSE(sse))
+	} else if pipe {
+		os.Exit(HandlePipe())
+	} else if sinceSpecVersion {
+		if len(file) == 0 {
+			fmt.Fprintln(os.Stderr, "-since-spec-version requires a file given with -f")
+			os.Exit(2)
+		}
+
+		os.Exit(HandleSinceSpecVersion(file))
+	} else if len(versions) > 0 {
+		if len(file) == 0 {
+			fmt.Fprintln(os.Stderr, "-versions requires a file given with -f")
+			os.Exit(2)
+		}
+
+		list := SpecVersions
+		if versions != "all" {
+			list = strings.Split(versions, ",")
+			for _, v := range list {
+				if !StringInSlice(v, SpecVersions) {
+					fmt.Fprintf(os.Stderr, "Unknown specversion %q (known are %s)\n", v, strings.Join(SpecVersions, ", "))
+					os.Exit(2)
+				}
+			}
+		}
+
+		os.Exit(HandleVersions(file, list))
+	} else if len(outputAttributes) > 0 {
+		if len(file) == 0 {
+			fmt.Fprintln(os.Stderr, "-output-attributes requires a file or directory given with -f")
+			os.Exit(2)
+		}
+
+		var attributes []string
+		for _, a := range strings.Split(outputAttributes, ",") {
+			if a = strings.TrimSpace(a); len(a) > 0 {
+				attributes = append(attributes, a)
+			}
+		}
+
+		os.Exit(HandleOutputAttributes(file, attributes))
+	} else if len(groupBy) > 0 {
+		if len(file) == 0 {
+			fmt.Fprintln(os.Stderr, "-group-by requires a file or directory given with -f")
+			os.Exit(2)
+		} else if !StringInSlice(groupBy, GroupAttributes) {
+			fmt.Fprintf(os.Stderr, "Cannot group by %q (only by %s)\n", groupBy, strings.Join(GroupAttributes, " or "))
+			os.Exit(2)
+		}
+
+		os.Exit(HandleGroupBy(file, groupBy))
+	} else if stats {
+		if len(file) == 0 {
+			fmt.Fprintln(os.Stderr, "-stats requires a file or directory given with -f")
+			os.Exit(2)
+		}
+
+		os.Exit(HandleStats(file))
+	} else if len(merge) > 0 {
+		if len(file) == 0 {
+			fmt.Fprintln(os.Stderr, "-merge requires a file given with -f")
+			os.Exit(2)
+		}
+
+		os.Exit(HandleMerge(merge, file))
+	} else if compare {
+		if len(file) == 0 || len(remote) == 0 {
+			fmt.Fprintln(os.Stderr, "-compare-to-server requires a file given with -f and a server given with -url")
+			os.Exit(2)
+		}
+
+		os.Exit(HandleCompare(remote, file))
+	} else if fix {
+		if len(file) == 0 {
+			fmt.Fprintln(os.Stderr, "-fix requires a file given with -f")
+			os.Exit(2)
+		}
+
+		os.Exit(HandleFix(file))
+	} else if jsonPointerErrors {
+		if len(file) == 0 {
+			fmt.Fprintln(os.Stderr, "-json-pointer-errors requires a file given with -f")
+			os.Exit(2)
+		}
+
+		os.Exit(HandleJSONPointerErrors(file))
+	} else if len(remote) > 0 {
+		os.Exit(HandleURL(remote))
+	} else if len(file) > 0 {
+		os.Exit(HandleFile(file))
 	} else {
-		http.HandleFunc("/", HandleServer)
+		if err := CheckTLS(crt, key); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		server := NewServer(port)
 
 		if len(crt) > 0 && len(key) > 0 {
-			if err := http.ListenAndServeTLS(":"+strconv.Itoa(port), crt, key, nil); err != nil {
+			if err := server.ListenAndServeTLS(crt, key); err != nil {
 				fmt.Fprintf(os.Stderr, "(HTTPS) Error listening on port %d:\n\t%s\n", port, err)
 				os.Exit(1)
 			}
-		} else if err := http.ListenAndServe(":"+strconv.Itoa(port), nil); err != nil {
+		} else if err := server.ListenAndServe(); err != nil {
 			fmt.Fprintf(os.Stderr, "(HTTP) Error listening on port %d:\n\t%s\n", port, err)
 			os.Exit(1)
 		}
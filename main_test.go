@@ -1,10 +1,31 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type TestValue struct {
@@ -36,6 +57,24 @@ func TestVerifyJSON(t *testing.T) {
 			{`"www.google.com"`, true},
 			{`"www. google .com"`, false},
 			{`"www.^^google^^.com"`, false},
+			{`"/mycontext"`, true},
+			{`"urn:event:from:myapi/resource/123"`, true},
+		}},
+		{"schemaurl", false, []TestValue{
+			{`null`, false},
+			{`""`, false},
+			{`"/schema"`, false},
+			{`"https://example.com/schema"`, true},
+		}},
+		{"dataschema", false, []TestValue{
+			{`null`, false},
+			{`""`, false},
+			{`5`, false},
+			{`"/schema"`, false},
+			{`"schema.json"`, false},
+			{`"../schemas/event.json"`, false},
+			{`"https://example.com/schema"`, true},
+			{`"urn:example:schema"`, true},
 		}},
 		{"id", true, []TestValue{
 			{`null`, false},
@@ -77,6 +116,12 @@ func TestVerifyJSON(t *testing.T) {
 			{`"multipart/appledouble"`, true},
 			{`"text/dns"`, true},
 			{`"video/ogg"`, true},
+			{`"application/json; charset=utf-8"`, true},
+			{`"text/plain; charset=\"utf-8\""`, true},
+			{`"application/json; charset"`, false},
+			{`"application/json; charset="`, false},
+			{`"application/json; =utf-8"`, false},
+			{`"application/json; charset=utf-8; charset=ascii"`, false},
 		}},
 	}
 
@@ -148,3 +193,3742 @@ func TestServer(t *testing.T) {
 		t.Errorf("Server handler returned incorrect status code (expected %d want %d):\n%s", rr.Code, http.StatusOK, rr.Body)
 	}
 }
+
+func TestServerHeaderOnly(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+
+	req.Header.Add("ce-specversion", "0.4")
+	req.Header.Add("ce-type", "com.example.someevent")
+	req.Header.Add("ce-id", "A234-1234-1234")
+	req.Header.Add("ce-source", "/mycontext")
+	req.Header.Add("ce-time", "2018-04-05T17:31:00Z")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(HandleServer)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Server handler returned incorrect status code (expected %d got %d):\n%s", http.StatusOK, rr.Code, rr.Body)
+	}
+
+	req = httptest.NewRequest("POST", "/", nil)
+
+	req.Header.Add("ce-specversion", "0.4")
+	req.Header.Add("ce-type", "com.example.someevent")
+	req.Header.Add("ce-source", "/mycontext")
+	req.Header.Add("ce-time", "yesterday")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Server handler returned incorrect status code (expected %d got %d):\n%s", http.StatusUnprocessableEntity, rr.Code, rr.Body)
+	}
+
+	for _, s := range []string{"HTTP header `id` is missing", "HTTP header `Ce-Time` is not a valid Timestamp"} {
+		if !strings.Contains(rr.Body.String(), s) {
+			t.Errorf("Header-only response is missing '%s':\n%s", s, rr.Body)
+		}
+	}
+
+	if strings.Contains(rr.Body.String(), "`data") {
+		t.Errorf("Header-only response should not report on data:\n%s", rr.Body)
+	}
+}
+
+func TestMaxSourceLength(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion": "0.4",
+		"type":        "com.example.someevent",
+		"id":          "A234-1234-1234",
+		"source":      "/" + strings.Repeat("a", MaxSourceLength-1),
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Source of maximum length should be valid: %s", r)
+	}
+
+	j["source"] = "/" + strings.Repeat("a", MaxSourceLength)
+
+	if r := VerifyJSON(j); !strings.Contains(r, "("+strconv.Itoa(MaxSourceLength+1)+" characters") {
+		t.Errorf("Over-long source should report its length: %s", r)
+	}
+
+	defer func(m int) { MaxSourceLength = m }(MaxSourceLength)
+	MaxSourceLength = 0
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Source length should be unlimited when the maximum is 0: %s", r)
+	}
+}
+
+type SyncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *SyncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *SyncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
+}
+
+func TestWatchFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "event.json")
+	valid := `{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext"}`
+	if err := ioutil.WriteFile(file, []byte(valid), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &SyncBuffer{}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		WatchFile(file, 5*time.Millisecond, out, stop)
+		close(done)
+	}()
+
+	wait := func(s string) {
+		for i := 0; i < 200 && !strings.Contains(out.String(), s); i++ {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if !strings.Contains(out.String(), s) {
+			t.Fatalf("Watch output is missing '%s':\n%s", s, out)
+		}
+	}
+
+	wait(file + ": valid")
+
+	if err := ioutil.WriteFile(file, []byte(`{"specversion":"0.4","type":"com.example.someevent","source":"/mycontext"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(file, later, later)
+
+	wait("Attribute `id` is missing")
+
+	close(stop)
+	<-done
+}
+
+func TestTypedExtensions(t *testing.T) {
+	defer func(r Rules) { LoadedRules = r }(LoadedRules)
+
+	file := filepath.Join(t.TempDir(), "rules.json")
+	ioutil.WriteFile(file, []byte(`{"extensions": {"dataref": "URI", "comexampleref": "URI-reference"}}`), 0644)
+
+	var err error
+	if LoadedRules, err = LoadRules(file); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name  string
+		Value string
+		Pass  bool
+	}{
+		{"dataref", "https://example.com/data/123", true},
+		{"dataref", "https://example.com/^^data^^", false},
+		{"dataref", "", false},
+		{"dataref", "/data/123", false},
+		{"comexampleref", "/data/123", true},
+		{"comexampleref", "../data/123?v=2", true},
+		{"comexampleref", "https://example.com/data/123", true},
+		{"comexampleref", "/data /123", false},
+	}
+
+	for _, test := range tests {
+		j := map[string]interface{}{
+			"specversion": "0.4",
+			"type":        "com.example.someevent",
+			"id":          "A234-1234-1234",
+			"source":      "/mycontext",
+			test.Name:     test.Value,
+		}
+
+		if r := VerifyJSON(j); (r == "") != test.Pass {
+			t.Errorf(`Verifying extension %s '%s' is incorrect (expected %t got %t): %s`, test.Name, test.Value, test.Pass, !test.Pass, r)
+		}
+	}
+
+	// like dataschema and unlike source, a URI extension has to be absolute
+	j := map[string]interface{}{"specversion": "1.0", "type": "t", "id": "1", "source": "/s", "dataref": "/data/123"}
+	if f := Verify(j); len(f) != 1 || f[0].Code != NotAbsoluteURI || f[0].Attribute != "dataref" {
+		t.Errorf("A relative URI extension should be reported as not absolute: %+v", f)
+	}
+
+	ioutil.WriteFile(file, []byte(`{"extensions": {"dataref": "Url"}}`), 0644)
+
+	if _, err := LoadRules(file); err == nil {
+		t.Errorf("Rules with an unknown extension type should not load")
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	nested := func(n int) string {
+		return `{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext","data":` +
+			strings.Repeat(`{"a":[`, n) + strings.Repeat(`]}`, n) + `}`
+	}
+
+	if err := CheckDepth([]byte(nested(MaxDepth/2 - 1))); err != nil {
+		t.Errorf("Document within the maximum depth was rejected: %s", err)
+	}
+
+	if err := CheckDepth([]byte(nested(100000))); err == nil {
+		t.Errorf("Pathologically nested document was not rejected")
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(nested(100000)))
+	req.Header.Add("content-type", "application/cloudevents+json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "nested too deeply") {
+		t.Errorf("Server did not reject a pathologically nested document (got %d):\n%s", rr.Code, rr.Body)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	server := NewServer(8080)
+
+	if server.Addr != ":8080" {
+		t.Errorf("Server has incorrect address (expected %s got %s)", ":8080", server.Addr)
+	}
+
+	if server.ReadHeaderTimeout != 10*time.Second || server.ReadTimeout != 30*time.Second || server.WriteTimeout != 30*time.Second {
+		t.Errorf("Server has incorrect default timeouts (got %s, %s, %s)", server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout)
+	}
+
+	defer func(d time.Duration) { ReadHeaderTimeout = d }(ReadHeaderTimeout)
+	ReadHeaderTimeout = time.Second
+
+	if server := NewServer(8080); server.ReadHeaderTimeout != time.Second {
+		t.Errorf("Server does not honor the configured header timeout (got %s)", server.ReadHeaderTimeout)
+	}
+}
+
+func TestExplainErrors(t *testing.T) {
+	j := map[string]interface{}{
+		"type":   "com.example.someevent",
+		"id":     "A234-1234-1234",
+		"source": "/mycontext",
+		"time":   "yesterday",
+		"MyExt":  "value",
+	}
+
+	if r := VerifyJSON(j); strings.Contains(r, SpecURL) {
+		t.Errorf("Findings should not reference the specification by default: %s", r)
+	}
+
+	defer func(e bool) { ExplainErrors = e }(ExplainErrors)
+	ExplainErrors = true
+
+	r := VerifyJSON(j)
+	for _, s := range []string{
+		"Attribute `specversion` is missing. (see \"Context Attributes: specversion\": " + SpecURL + "#specversion)\n",
+		"Attribute `time` is not a valid Timestamp (see \"Context Attributes: time\": " + SpecURL + "#time)\n",
+		"(see \"Attribute Naming Convention\": " + SpecURL + "#attribute-naming-convention)\n",
+	} {
+		if !strings.Contains(r, s) {
+			t.Errorf("Explained findings are missing '%s':\n%s", s, r)
+		}
+	}
+}
+
+func TestFindingCodes(t *testing.T) {
+	tests := []struct {
+		Event     string
+		Code      string
+		Attribute string
+	}{
+		{`{"type":"t","id":"1","source":"/s"}`, MissingRequired, "specversion"},
+		{`{"specversion":"0.4","type":"t","id":"1","source":"/s","subject":null}`, NullValue, "subject"},
+		{`{"specversion":"0.4","type":"t","id":1,"source":"/s"}`, WrongType, "id"},
+		{`{"specversion":"0.4","type":"","id":"1","source":"/s"}`, EmptyString, "type"},
+		{`{"specversion":"0.4","type":"t","id":"1","source":"/my context"}`, InvalidURI, "source"},
+		{`{"specversion":"0.4","type":"t","id":"1","source":"/s","dataschema":"/schema"}`, NotAbsoluteURI, "dataschema"},
+		{`{"specversion":"0.4","type":"t","id":"1","source":"/s","time":"yesterday"}`, InvalidTimestamp, "time"},
+		{`{"specversion":"0.4","type":"t","id":"1","source":"/s","datacontentencoding":"asdf"}`, InvalidEncoding, "datacontentencoding"},
+		{`{"specversion":"0.4","type":"t","id":"1","source":"/s","datacontenttype":"asdf"}`, InvalidMediaType, "datacontenttype"},
+		{`{"specversion":"0.4","type":"t","id":"1","source":"/s","datacontenttype":"application/json; charset"}`, MalformedMediaTypeParameter, "datacontenttype"},
+		{`{"specversion":"0.4","type":"t","id":"1","source":"/s","MyExt":"value"}`, BadExtensionName, "MyExt"},
+	}
+
+	for _, test := range tests {
+		var j map[string]interface{}
+		json.Unmarshal([]byte(test.Event), &j)
+
+		findings := Verify(j)
+		if len(findings) != 1 || findings[0].Code != test.Code || findings[0].Attribute != test.Attribute {
+			t.Errorf("Verifying %s should only find %s on `%s`: %+v", test.Event, test.Code, test.Attribute, findings)
+		}
+	}
+}
+
+func TestServerJSON(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"0.4","type":"t","source":"/s"}`))
+	req.Header.Add("content-type", "application/cloudevents+json")
+	req.Header.Add("accept", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+	var result Result
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Server did not return JSON: %s\n%s", err, rr.Body)
+	}
+
+	if rr.Code != http.StatusUnprocessableEntity || result.Valid || len(result.Findings) != 1 || result.Findings[0].Code != MissingRequired || result.Findings[0].Attribute != "id" {
+		t.Errorf("Server returned an incorrect JSON result (got %d): %s", rr.Code, rr.Body)
+	}
+}
+
+func TestServerMissingContentType(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"0.4"}`))
+	req.Header.Add("accept", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+	var result Result
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Server did not return JSON: %s\n%s", err, rr.Body)
+	}
+
+	if rr.Code != http.StatusBadRequest || result.Valid || len(result.Findings) != 1 || result.Findings[0].Code != MissingContentType {
+		t.Errorf("Server returned an incorrect JSON result (got %d): %s", rr.Code, rr.Body)
+	}
+}
+
+func TestContentTypeWithoutData(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion":     "0.4",
+		"type":            "com.example.someevent",
+		"id":              "A234-1234-1234",
+		"source":          "/mycontext",
+		"datacontenttype": "application/json",
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Content type without data should only be flagged in strict mode: %s", r)
+	}
+
+	defer func(s bool) { Strict = s }(Strict)
+	Strict = true
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != ContentTypeWithoutData {
+		t.Errorf("Content type without data was not flagged in strict mode: %+v", f)
+	}
+
+	j["data"] = map[string]interface{}{"a": 1}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Content type with data should be valid in strict mode: %s", r)
+	}
+
+	delete(j, "data")
+	j["data_base64"] = "YQ=="
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Content type with data_base64 should be valid in strict mode: %s", r)
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	defer func(p string) { JSONPointer = p }(JSONPointer)
+
+	doc := []byte(`{
+		"event": {"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext"},
+		"metadata": {"received": "2018-04-05T17:31:00Z"},
+		"a/b": [{"id":"A234-1234-1234"}]
+	}`)
+
+	JSONPointer = "/event"
+	if j, err := ParseEvent(doc, false); err != nil {
+		t.Errorf("Event could not be extracted from /event: %s", err)
+	} else if r := VerifyJSON(j); r != "" {
+		t.Errorf("Event extracted from /event should be valid: %s", r)
+	}
+
+	JSONPointer = "/a~1b/0"
+	if j, err := ParseEvent(doc, false); err != nil || j["id"] != "A234-1234-1234" {
+		t.Errorf("Event could not be extracted from /a~1b/0: %v", err)
+	}
+
+	for _, p := range []string{"/missing", "/event/id", "/a~1b/1", "event"} {
+		JSONPointer = p
+		if _, err := ParseEvent(doc, false); err == nil {
+			t.Errorf("Unresolvable JSON pointer %s did not report an error", p)
+		}
+	}
+}
+
+func TestMaxIDLength(t *testing.T) {
+	defer func(s bool, m int) { Strict, MaxIDLength = s, m }(Strict, MaxIDLength)
+
+	j := map[string]interface{}{
+		"specversion": "0.4",
+		"type":        "com.example.someevent",
+		"id":          strings.Repeat("a", 100),
+		"source":      "/mycontext",
+	}
+
+	Strict = true
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Id length should be unlimited by default: %s", r)
+	}
+
+	MaxIDLength = 64
+	Strict = false
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Id length should only be limited in strict mode: %s", r)
+	}
+
+	Strict = true
+	if f := Verify(j); len(f) != 1 || f[0].Code != TooLong || !strings.Contains(f[0].Message, "(100 characters, maximum is 64)") {
+		t.Errorf("Over-long id was not reported with its length: %+v", f)
+	}
+}
+
+func TestDebugHeaders(t *testing.T) {
+	req := httptest.NewRequest("POST", "/debug/headers", strings.NewReader("body"))
+	req.Header.Add("content-type", "Text/Plain")
+	req.Header.Add("ce-id", "A234-1234-1234")
+	req.Header.Add("CE-SomeExtension", "5")
+	req.Header.Add("x-ce-other", "ignored")
+
+	rr := httptest.NewRecorder()
+	NewServer(80).Handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Debug route should be disabled by default (got %d):\n%s", rr.Code, rr.Body)
+	}
+
+	defer func(d bool) { Debug = d }(Debug)
+	Debug = true
+
+	rr = httptest.NewRecorder()
+	NewServer(80).Handler.ServeHTTP(rr, req)
+
+	var mappings []HeaderMapping
+	if err := json.Unmarshal(rr.Body.Bytes(), &mappings); err != nil {
+		t.Fatalf("Debug route did not return JSON: %s\n%s", err, rr.Body)
+	}
+
+	expected := []HeaderMapping{
+		{"Ce-Id", "id", "A234-1234-1234"},
+		{"Ce-Someextension", "someextension", "5"},
+		{"Content-Type", "datacontenttype", "text/plain"},
+	}
+	if !reflect.DeepEqual(mappings, expected) {
+		t.Errorf("Debug route returned an incorrect mapping (expected %+v got %+v)", expected, mappings)
+	}
+}
+
+func TestHeaderCollisions(t *testing.T) {
+	h := http.Header{}
+	h.Add("ce-specversion", "0.4")
+	h.Add("ce-type", "com.example.someevent")
+	h.Add("ce-id", "A234-1234-1234")
+	h.Add("ce-source", "/mycontext")
+	h.Add("ce-myext", "a")
+	h.Add("ce-MyExt", "b")
+
+	_, findings := HeaderAttributes(h)
+	if len(findings) != 1 || findings[0].Code != DuplicateAttribute || !strings.Contains(findings[0].Message, "`Ce-Myext` is given 2 times") {
+		t.Errorf("Headers differing only in case were not reported: %+v", findings)
+	}
+
+	h = http.Header{"ce-myext": {"a"}, "ce-MyExt": {"b"}}
+
+	_, findings = HeaderAttributes(h)
+	if len(findings) != 1 || findings[0].Code != DuplicateAttribute || !strings.Contains(findings[0].Message, "`ce-MyExt` and `ce-myext`") {
+		t.Errorf("Non-canonical headers differing only in case were not reported: %+v", findings)
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Add("ce-specversion", "0.4")
+	req.Header.Add("ce-type", "com.example.someevent")
+	req.Header.Add("ce-id", "A234-1234-1234")
+	req.Header.Add("ce-source", "/mycontext")
+	req.Header.Add("ce-myext", "a")
+	req.Header.Add("ce-MyExt", "b")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "`Ce-Myext`") {
+		t.Errorf("Server did not reject headers differing only in case (got %d):\n%s", rr.Code, rr.Body)
+	}
+}
+
+func TestFixEvent(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion": "0.4",
+		"Type":        "com.example.someevent",
+		"id":          "A234-1234-1234",
+		"ID":          "B234-1234-1234",
+		"source":      "/mycontext",
+		"My_Ext":      "value",
+	}
+
+	FixEvent(j)
+
+	if _, ok := j["type"]; !ok || j["ID"] != "B234-1234-1234" || j["id"] != "A234-1234-1234" || j["My_Ext"] != "value" {
+		t.Errorf("Attribute names were not fixed correctly: %v", j)
+	}
+}
+
+func TestCompactJSON(t *testing.T) {
+	defer func(c bool) { CompactJSON = c }(CompactJSON)
+
+	j := map[string]interface{}{
+		"specversion": "0.4",
+		"type":        "com.example.someevent",
+		"id":          "A234-1234-1234",
+		"source":      "/mycontext",
+		"data":        map[string]interface{}{"a": []interface{}{1.0, "b"}},
+	}
+
+	CompactJSON = false
+	pretty, err := MarshalEvent(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CompactJSON = true
+	compact, err := MarshalEvent(j)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(pretty, []byte("\n")) || bytes.Contains(compact, []byte("\n")) {
+		t.Errorf("Pretty and compact JSON are not formatted correctly:\n%s\n%s", pretty, compact)
+	}
+
+	var p, c interface{}
+	if err := json.Unmarshal(pretty, &p); err != nil {
+		t.Errorf("Pretty JSON is not valid: %s", err)
+	}
+	if err := json.Unmarshal(compact, &c); err != nil {
+		t.Errorf("Compact JSON is not valid: %s", err)
+	}
+	if !reflect.DeepEqual(p, c) || !reflect.DeepEqual(c, j) {
+		t.Errorf("Pretty and compact JSON do not parse to the same value:\n%v\n%v", p, c)
+	}
+}
+
+func TestSubjectPattern(t *testing.T) {
+	defer func(p *regexp.Regexp) { SubjectPattern = p }(SubjectPattern)
+	SubjectPattern = regexp.MustCompile(`^(?:/orders/[0-9]+)$`)
+
+	j := map[string]interface{}{
+		"specversion": "0.4",
+		"type":        "com.example.someevent",
+		"id":          "A234-1234-1234",
+		"source":      "/mycontext",
+		"subject":     "/orders/123",
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Subject matching the pattern should be valid: %s", r)
+	}
+
+	j["subject"] = "/orders/123/items"
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != PatternMismatch || !strings.Contains(f[0].Message, `"/orders/123/items"`) {
+		t.Errorf("Subject not matching the pattern was not reported with its value: %+v", f)
+	}
+
+	delete(j, "subject")
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Missing subject should not be checked against the pattern: %s", r)
+	}
+}
+
+func TestFetchURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/event.json":
+			w.Write([]byte(`{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext"}`))
+		case "/batch.json":
+			w.Write([]byte(`[{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext"},{"specversion":"0.4"}]`))
+		case "/large.json":
+			w.Write(bytes.Repeat([]byte(" "), 1024))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	body, err := FetchURL(server.URL + "/event.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events, batch, err := ParseEvents(body, false); err != nil || batch || len(events) != 1 || VerifyJSON(events[0]) != "" {
+		t.Errorf("Fetched event should be a single valid event: %v %v", events, err)
+	}
+
+	body, err = FetchURL(server.URL + "/batch.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events, batch, err := ParseEvents(body, false); err != nil || !batch || len(events) != 2 || VerifyJSON(events[0]) != "" || VerifyJSON(events[1]) == "" {
+		t.Errorf("Fetched batch should hold one valid and one invalid event: %v %v", events, err)
+	}
+
+	if _, err := FetchURL(server.URL + "/missing.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Fetching a missing event should report the status: %v", err)
+	}
+
+	defer func(m int64) { MaxBodySize = m }(MaxBodySize)
+	MaxBodySize = 512
+
+	if _, err := FetchURL(server.URL + "/large.json"); err != ErrBodyTooLarge {
+		t.Errorf("Fetching an oversized body should fail: %v", err)
+	}
+}
+
+func TestBatchSpecVersion(t *testing.T) {
+	events, _, err := ParseEvents([]byte(`[
+		{"specversion":"0.3","type":"com.example.someevent","id":"1","source":"/mycontext"},
+		{"specversion":"1.0","type":"com.example.someevent","id":"2","source":"/mycontext"},
+		{"specversion":"0.3","type":"com.example.someevent","id":"3","source":"/mycontext"}
+	]`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := NewBatchResult(context.Background(), events, nil); !result.Valid {
+		t.Errorf("Mixed specversion should only be flagged in strict mode: %+v", result)
+	}
+
+	defer func(s bool) { Strict = s }(Strict)
+	Strict = true
+
+	result := NewBatchResult(context.Background(), events, nil)
+	if result.Valid || len(result.Findings) != 1 || result.Findings[0].Code != InconsistentSpecVersion || !strings.Contains(result.Findings[0].Message, `("0.3", "1.0")`) {
+		t.Errorf("Mixed specversion was not reported with the versions found: %+v", result)
+	}
+
+	if result := NewBatchResult(context.Background(), events[:1], nil); !result.Valid {
+		t.Errorf("Consistent specversion should be valid in strict mode: %+v", result)
+	}
+}
+
+func TestEchoAttributes(t *testing.T) {
+	defer func(e bool) { EchoAttributes = e }(EchoAttributes)
+
+	request := func() *Result {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("secret"))
+		req.Header.Add("content-type", "text/plain")
+		req.Header.Add("accept", "application/json")
+		req.Header.Add("ce-specversion", "0.4")
+		req.Header.Add("ce-type", "com.example.someevent")
+		req.Header.Add("ce-id", "A234-1234-1234")
+		req.Header.Add("ce-source", "/mycontext")
+		req.Header.Add("ce-someextension", "5")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+		var result Result
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Server did not return JSON: %s\n%s", err, rr.Body)
+		}
+		return &result
+	}
+
+	if result := request(); result.Attributes != nil {
+		t.Errorf("Attributes should not be echoed by default: %v", result.Attributes)
+	}
+
+	EchoAttributes = true
+
+	expected := map[string]interface{}{
+		"specversion":     "0.4",
+		"type":            "com.example.someevent",
+		"id":              "A234-1234-1234",
+		"source":          "/mycontext",
+		"someextension":   "5",
+		"datacontenttype": "text/plain",
+	}
+	if result := request(); !reflect.DeepEqual(result.Attributes, expected) {
+		t.Errorf("Echoed attributes are incorrect (expected %v got %v)", expected, result.Attributes)
+	}
+}
+
+func TestBinaryProvenance(t *testing.T) {
+	h := http.Header{}
+	h.Add("content-type", "text/plain")
+	h.Add("ce-specversion", "0.4")
+	h.Add("ce-type", "com.example.someevent")
+	h.Add("ce-id", "A234-1234-1234")
+	h.Add("ce-source", "/mycontext")
+
+	j, provenance, findings := BinaryAttributes(h, []byte("body"))
+	if len(findings) != 0 {
+		t.Errorf("Binary attributes from the right places should be valid: %+v", findings)
+	}
+
+	for _, e := range Attributes {
+		if _, ok := j[e.Name]; ok && e.Required && provenance[e.Name] != FromHeader {
+			t.Errorf("Required attribute `%s` came from the %s", e.Name, provenance[e.Name])
+		}
+	}
+
+	if provenance["datacontenttype"] != FromContentType || provenance["data"] != FromBody || !reflect.DeepEqual(j["data"], []byte("body")) {
+		t.Errorf("Data attributes came from the wrong places: %v", provenance)
+	}
+
+	h.Add("ce-datacontenttype", "application/json")
+	if _, _, findings := BinaryAttributes(h, []byte("body")); len(findings) != 1 || findings[0].Code != WrongProvenance || findings[0].Attribute != "datacontenttype" {
+		t.Errorf("A `ce-datacontenttype` header was not reported: %+v", findings)
+	}
+}
+
+func TestListChecks(t *testing.T) {
+	defer func(r Rules) { LoadedRules = r }(LoadedRules)
+	LoadedRules = Rules{Extensions: map[string]string{"dataref": "URI-reference"}}
+
+	checks := ListChecks()
+
+	has := func(c CheckInfo) bool {
+		for _, e := range checks {
+			if reflect.DeepEqual(e, c) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, c := range []CheckInfo{
+		{"`id` is present", "id", "error", "always", []string{MissingRequired}},
+		{"`time` is a valid Timestamp", "time", "error", "always", []string{WrongType, InvalidTimestamp}},
+		{"`dataref` is a valid URI-reference", "dataref", "error", "rules", []string{WrongType, EmptyString, InvalidURI}},
+		{EventChecks[0].Name, "datacontenttype", "warning", "strict", []string{ContentTypeWithoutData}},
+		{BatchChecks[0].Name, "specversion", "warning", "batch and strict", []string{InconsistentSpecVersion}},
+	} {
+		if !has(c) {
+			t.Errorf("Check list is missing %+v", c)
+		}
+	}
+
+	for _, e := range Attributes {
+		if !has(CheckInfo{"`" + e.Name + "` is a valid " + e.Type, e.Name, "error", "always", TypeCodes[e.Type]}) {
+			t.Errorf("Check list is missing attribute `%s`", e.Name)
+		}
+	}
+}
+
+func TestListChecksCodes(t *testing.T) {
+	defer func(r Rules) { LoadedRules = r }(LoadedRules)
+	LoadedRules = Rules{Extensions: map[string]string{}}
+	for typ := range ExtensionTypes {
+		LoadedRules.Extensions["ext"+strconv.Itoa(len(LoadedRules.Extensions))] = typ
+	}
+
+	listed := map[string]bool{}
+	for _, c := range ListChecks() {
+		for _, code := range c.Codes {
+			listed[code] = true
+		}
+	}
+
+	for _, code := range codeConstants(t) {
+		// No attribute is a map, so CheckMap never reports empty_map.
+		if !listed[code] && code != EmptyMap {
+			t.Errorf("No check lists the code %s", code)
+		}
+	}
+}
+
+func TestURISchemeCase(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion": "0.4",
+		"type":        "com.example.someevent",
+		"id":          "A234-1234-1234",
+		"source":      "HTTP://example.com/Path",
+		"dataschema":  "Https://example.com/schema",
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Uppercase schemes should only be flagged in strict mode: %s", r)
+	}
+
+	defer func(s bool) { Strict = s }(Strict)
+	Strict = true
+
+	f := Verify(j)
+	if len(f) != 2 || f[0].Code != UppercaseScheme || !strings.Contains(f[0].Message, `"http://example.com/Path"`) || f[1].Code != UppercaseScheme {
+		t.Errorf("Uppercase schemes were not reported with their normalized form: %+v", f)
+	}
+
+	// an invalid URI is reported as such, not only for the case of its scheme
+	invalid := map[string]interface{}{"dataschema": "HTTP:///path"}
+	if f := CheckAbsoluteURI(invalid, "dataschema"); f == nil || f.Code != MissingHost {
+		t.Errorf("HTTP:///path should be reported as %s, got %+v", MissingHost, f)
+	}
+
+	FixEvent(j)
+
+	if j["source"] != "http://example.com/Path" || j["dataschema"] != "https://example.com/schema" {
+		t.Errorf("Schemes were not normalized: %v", j)
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Normalized schemes should be valid in strict mode: %s", r)
+	}
+}
+
+func TestInputFormats(t *testing.T) {
+	valid := map[string]interface{}{
+		"specversion": "0.4",
+		"type":        "com.example.someevent",
+		"id":          "A234-1234-1234",
+		"source":      "/mycontext",
+		"data":        map[string]interface{}{"list": []interface{}{1.0, "two", true, nil}, "text": "line 1\nline 2\n"},
+	}
+
+	tests := []struct {
+		Format string
+		Input  string
+		Batch  bool
+		Count  int
+	}{
+		{"json", `{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext","data":{"list":[1,"two",true,null],"text":"line 1\nline 2\n"}}`, false, 1},
+		{"json", `[{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext","data":{"list":[1,"two",true,null],"text":"line 1\nline 2\n"}}]`, true, 1},
+		{"ndjson", `{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext","data":{"list":[1,"two",true,null],"text":"line 1\nline 2\n"}}
+
+{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","source":"/mycontext","data":{"list":[1,"two",true,null],"text":"line 1\nline 2\n"}}
+`, true, 2},
+		{"yaml", `---
+# a comment
+specversion: "0.4"
+type: com.example.someevent # trailing comment
+id: 'A234-1234-1234'
+source: /mycontext
+data:
+  list:
+  - 1
+  - two
+  - true
+  - ~
+  text: |
+    line 1
+    line 2
+`, false, 1},
+		{"yaml", `- specversion: "0.4"
+  type: com.example.someevent
+  id: A234-1234-1234
+  source: /mycontext
+  data: {"list": [1, "two", true, null], "text": "line 1\nline 2\n"}
+`, true, 1},
+		{"yaml", `-
+  specversion: "0.4"
+  type: com.example.someevent
+  id: A234-1234-1234
+  source: /mycontext
+  data:
+    list:
+    - 1
+    - two
+    - true
+    -
+    text: "line 1\nline 2\n"
+`, true, 1},
+	}
+
+	for _, test := range tests {
+		events, batch, err := ParseInput(strings.NewReader(test.Input), test.Format, false)
+		if err != nil {
+			t.Errorf("Reading %s failed: %s\n%s", test.Format, err, test.Input)
+			continue
+		}
+
+		if batch != test.Batch || len(events) != test.Count {
+			t.Errorf("Reading %s returned %d events (batch %t), expected %d (batch %t)", test.Format, len(events), batch, test.Count, test.Batch)
+		}
+
+		for _, j := range events {
+			if !reflect.DeepEqual(j, valid) {
+				t.Errorf("Reading %s returned an incorrect event:\n%v\n%v", test.Format, j, valid)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		Format string
+		Input  string
+	}{
+		{"json", `specversion: "0.4"`},
+		{"yaml", "specversion: \"0.4\"\n  type: t\n"},
+		{"yaml", "id: 1\nid: 2\n"},
+		{"yaml", "id: &a 1\nsource: *a\n"},
+		{"yaml", "id: !!str 1\n"},
+		{"yaml", "id: 1\n---\nid: 2\n"},
+		{"yaml", "id: 1\n...\n"},
+		{"yaml", "- \n"},
+		{"yaml", "data: |+\n  text\n"},
+		{"yaml", "subject: a: b\n"},
+		{"yaml", "id: 'it's'\n"},
+		{"yaml", "id: \"\\101\"\n"},
+		{"yaml", "id: 0x1F\n"},
+		{"yaml", "? id\n: 1\n"},
+		{"ndjson", "{}\n[]\n"},
+		{"xml", "<event/>"},
+	} {
+		if _, _, err := ParseInput(strings.NewReader(test.Input), test.Format, false); err == nil {
+			t.Errorf("Reading malformed %s did not fail:\n%s", test.Format, test.Input)
+		}
+	}
+
+	for name, format := range map[string]string{"a.json": "json", "a.YAML": "yaml", "a.yml": "yaml", "a.ndjson": "ndjson", "a.jsonl": "ndjson", "-": "json"} {
+		if f := DetectFormat(name); f != format {
+			t.Errorf("Detected format of %s is incorrect (expected %s got %s)", name, format, f)
+		}
+	}
+}
+
+func TestDocumentType(t *testing.T) {
+	for _, test := range []struct {
+		Input, Message string
+	}{
+		{"null", "a CloudEvent must be a JSON object or an array of them (is currently null)"},
+		{"1.5", "a CloudEvent must be a JSON object or an array of them (is currently a number)"},
+		{`"event"`, "a CloudEvent must be a JSON object or an array of them (is currently a string)"},
+		{`[{"id":"1"}, null]`, "event 1 of the batch must be a JSON object (is currently null)"},
+		{"[true]", "event 0 of the batch must be a JSON object (is currently a boolean)"},
+	} {
+		if _, _, err := ParseEvents([]byte(test.Input), true); err == nil || err.Error() != test.Message {
+			t.Errorf("Document %s should be rejected with %q, got %v", test.Input, test.Message, err)
+		}
+	}
+
+	if _, err := ParseEvent([]byte("[]"), true); err == nil || err.Error() != "a CloudEvent must be a JSON object (is currently an array)" {
+		t.Errorf("An array should be rejected as a single event, got %v", err)
+	}
+}
+
+func TestCaseVariantNames(t *testing.T) {
+	var j map[string]interface{}
+	json.Unmarshal([]byte(`{"specversion":"0.4","type":"com.example.someevent","id":"A234-1234-1234","Id":"B234-1234-1234","source":"/mycontext"}`), &j)
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != CaseVariant || f[0].Attribute != "Id" || !strings.Contains(f[0].Message, "use `id`") {
+		t.Errorf("`Id` alongside `id` was not reported as a case variant: %+v", f)
+	}
+
+	delete(j, "id")
+
+	if f := Verify(j); len(f) != 2 || f[0].Code != MissingRequired || f[1].Code != CaseVariant {
+		t.Errorf("`Id` without `id` was not reported as a case variant of the core attribute: %+v", f)
+	}
+
+	j["id"], j["MyExt"] = "A234-1234-1234", "value"
+	delete(j, "Id")
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != BadExtensionName {
+		t.Errorf("`MyExt` should not be reported as a case variant: %+v", f)
+	}
+}
+
+func TestReadStdin(t *testing.T) {
+	for _, input := range []string{"", " \n\t"} {
+		if _, err := ReadStdin(strings.NewReader(input)); err != ErrNoInput {
+			t.Errorf("Empty stdin %q should report that there is no input (got %v)", input, err)
+		}
+	}
+
+	if body, err := ReadStdin(strings.NewReader("{}")); err != nil || string(body) != "{}" {
+		t.Errorf("Stdin was not read correctly: %q %v", body, err)
+	}
+}
+
+func TestEncodingWithoutData(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion":         "0.3",
+		"type":                "com.example.someevent",
+		"id":                  "A234-1234-1234",
+		"source":              "/mycontext",
+		"datacontentencoding": "base64",
+	}
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != EncodingWithoutData {
+		t.Errorf("datacontentencoding without data was not reported: %+v", f)
+	}
+
+	j["data"] = "YQ=="
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("datacontentencoding with data should be valid: %s", r)
+	}
+
+	delete(j, "data")
+	j["specversion"] = "0.4"
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("datacontentencoding without data should only be reported for 0.3: %s", r)
+	}
+}
+
+func TestOnly(t *testing.T) {
+	defer func(o string) { Only = o }(Only)
+	Only = "time"
+
+	j := map[string]interface{}{
+		"type":   "",
+		"source": "/my context",
+		"MyExt":  "value",
+	}
+
+	if f := Verify(j); len(f) != 0 {
+		t.Errorf("Only `time` should be checked: %+v", f)
+	}
+
+	j["time"] = "yesterday"
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != InvalidTimestamp {
+		t.Errorf("Only `time` should be checked: %+v", f)
+	}
+
+	Only = "id"
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != MissingRequired || f[0].Attribute != "id" {
+		t.Errorf("Only the presence of `id` should be checked: %+v", f)
+	}
+
+	defer func(s bool) { Strict = s }(Strict)
+	Strict = true
+	j["id"] = "1"
+	j["subject"] = "café"
+	j["count"] = "42"
+
+	for _, c := range []struct {
+		only, code string
+	}{
+		{"subject", NonASCII},
+		{"count", SuspiciousString},
+	} {
+		Only = c.only
+		if f := Verify(j); len(f) != 1 || f[0].Code != c.code || f[0].Attribute != c.only {
+			t.Errorf("Only the checks of every attribute should be run on `%s`: %+v", c.only, f)
+		}
+	}
+
+	Only = "time"
+
+	for _, c := range PerformedChecks() {
+		if c.Attribute != "time" {
+			t.Errorf("Check %+v should not be performed", c)
+		}
+	}
+}
+
+func TestAttributeStats(t *testing.T) {
+	events := []map[string]interface{}{
+		{"specversion": "1.0", "id": "1", "type": "t", "source": "/s", "traceparent": "00", "data": "x"},
+		{"specversion": "1.0", "id": "2", "type": "t", "source": "/s", "traceparent": "00"},
+		{"specversion": "1.0", "id": "3", "type": "t", "source": "/s", "partitionkey": "a"},
+	}
+
+	expected := []AttributeStat{
+		{"id", false, 3},
+		{"source", false, 3},
+		{"specversion", false, 3},
+		{"type", false, 3},
+		{"traceparent", true, 2},
+		{"data", false, 1},
+		{"partitionkey", true, 1},
+	}
+
+	if stats := AttributeStats(events); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Attribute stats were %+v, expected %+v", stats, expected)
+	}
+
+	dir, err := ioutil.TempDir("", "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(`[{"id": "1"}, {"id": "2"}]`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.yaml"), []byte("id: 3\n"), 0644)
+
+	if events, err := ReadEvents(dir); err != nil || len(events) != 3 {
+		t.Errorf("Reading the directory returned %d events, %v", len(events), err)
+	}
+}
+
+func TestTimePrecision(t *testing.T) {
+	defer func(s bool) { Strict = s }(Strict)
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"id":          "1",
+		"type":        "t",
+		"source":      "/s",
+		"time":        "2020-01-01T00:00:00.123456789012Z",
+	}
+
+	Strict = false
+	if f := Verify(j); len(f) != 0 {
+		t.Errorf("12 fractional second digits should be valid by default: %+v", f)
+	}
+
+	Strict = true
+	if f := Verify(j); len(f) != 1 || f[0].Code != ExcessPrecision || !strings.Contains(f[0].Message, "12 fractional") {
+		t.Errorf("12 fractional second digits were not reported in strict mode: %+v", f)
+	}
+
+	j["time"] = "2020-01-01T00:00:00.123456789Z"
+	if f := Verify(j); len(f) != 0 {
+		t.Errorf("9 fractional second digits should be valid in strict mode: %+v", f)
+	}
+}
+
+func TestMergeAttributes(t *testing.T) {
+	body := map[string]interface{}{
+		"specversion": "1.0",
+		"id":          "1",
+		"type":        "t",
+		"source":      "/s",
+	}
+
+	h := http.Header{}
+	h.Set("ce-id", "1")
+	h.Set("ce-subject", "sub")
+
+	j, findings := MergeAttributes(h, body)
+	if len(findings) != 0 || j["subject"] != "sub" || j["id"] != "1" {
+		t.Errorf("Merging agreeing attributes returned %+v, %+v", j, findings)
+	}
+
+	h.Set("ce-type", "other")
+
+	j, findings = MergeAttributes(h, body)
+	if len(findings) != 1 || findings[0].Code != ConflictingAttribute || findings[0].Attribute != "type" {
+		t.Errorf("Conflicting `type` was not reported: %+v", findings)
+	}
+	if j["type"] != "other" || body["type"] != "t" {
+		t.Errorf("The header should take precedence without changing the body: %+v, %+v", j, body)
+	}
+
+	file, err := ioutil.TempFile("", "headers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("ce-id: 1\nCe-Type: other\n")
+	file.Close()
+
+	if h, err := ReadHeaders(file.Name()); err != nil || h.Get("Ce-Id") != "1" || h.Get("Ce-Type") != "other" {
+		t.Errorf("Reading the headers returned %+v, %v", h, err)
+	}
+}
+
+func TestTypeRules(t *testing.T) {
+	defer func(r Rules) { LoadedRules = r }(LoadedRules)
+
+	file := filepath.Join(t.TempDir(), "rules.json")
+	ioutil.WriteFile(file, []byte(`{"types": [{"pattern": "com\\.x\\.payment", "required": ["amount"]}]}`), 0644)
+
+	var err error
+	if LoadedRules, err = LoadRules(file); err != nil {
+		t.Fatal(err)
+	}
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "com.x.payment",
+		"id":          "1",
+		"source":      "/s",
+	}
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != MissingRequired || f[0].Attribute != "amount" || !strings.Contains(f[0].Message, `"com\\.x\\.payment"`) {
+		t.Errorf("Missing `amount` for a matching type was not reported: %+v", f)
+	}
+
+	j["amount"] = "10"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Event with `amount` should be valid: %s", r)
+	}
+
+	delete(j, "amount")
+	j["type"] = "com.x.paymentrefund"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("`amount` should not be required for a non-matching type: %s", r)
+	}
+
+	ioutil.WriteFile(file, []byte(`{"types": [{"pattern": "com.(x", "required": ["amount"]}]}`), 0644)
+	if _, err := LoadRules(file); err == nil {
+		t.Error("Invalid type pattern was accepted")
+	}
+}
+
+func TestSuspiciousStrings(t *testing.T) {
+	defer func(s bool) { Strict = s }(Strict)
+	defer func(r Rules) { LoadedRules = r }(LoadedRules)
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"retriable":   "true",
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("A quoted boolean should only be flagged in strict mode: %s", r)
+	}
+
+	Strict = true
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != SuspiciousString || f[0].Attribute != "retriable" || !strings.Contains(f[0].Message, `"true"`) {
+		t.Errorf("A quoted boolean was not flagged in strict mode: %+v", f)
+	}
+
+	if f := VerifyHeaders(context.Background(), j, nil); len(f) != 0 {
+		t.Errorf("A quoted boolean should not be flagged for headers: %+v", f)
+	}
+
+	j["retriable"] = true
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("A boolean should be valid in strict mode: %s", r)
+	}
+
+	LoadedRules = Rules{Extensions: map[string]string{"retriable": "Boolean", "attempt": "Integer"}}
+
+	for _, test := range []struct {
+		Value interface{}
+		Pass  bool
+	}{
+		{true, true},
+		{"true", false},
+		{"yes", false},
+		{1.0, false},
+	} {
+		j["retriable"] = test.Value
+		if r := VerifyJSON(j); (r == "") != test.Pass {
+			t.Errorf("Boolean `retriable` of %#v was not verified correctly: %s", test.Value, r)
+		}
+	}
+	j["retriable"] = true
+
+	for _, test := range []struct {
+		Value interface{}
+		Pass  bool
+	}{
+		{3.0, true},
+		{"3", false},
+		{3.5, false},
+		{"three", false},
+		{true, false},
+	} {
+		j["attempt"] = test.Value
+		if r := VerifyJSON(j); (r == "") != test.Pass {
+			t.Errorf("Integer `attempt` of %#v was not verified correctly: %s", test.Value, r)
+		}
+	}
+
+	// binary mode carries every attribute as a string
+	for _, test := range []struct {
+		Retriable, Attempt string
+		Pass               bool
+	}{
+		{"true", "3", true},
+		{"false", "-5", true},
+		{"yes", "3", false},
+		{"true", "three", false},
+		{"true", "4294967296", false},
+	} {
+		h := http.Header{}
+		h.Set("ce-specversion", "1.0")
+		h.Set("ce-type", "t")
+		h.Set("ce-id", "1")
+		h.Set("ce-source", "/s")
+		h.Set("ce-retriable", test.Retriable)
+		h.Set("ce-attempt", test.Attempt)
+
+		j, _ := HeaderAttributes(h)
+		if f := VerifyHeaders(context.Background(), j, h); (len(f) == 0) != test.Pass {
+			t.Errorf("Headers `ce-retriable: %s` and `ce-attempt: %s` were not verified correctly: %+v", test.Retriable, test.Attempt, f)
+		}
+	}
+}
+
+type NDJSONGenerator struct {
+	Lines int
+	line  []byte
+	rest  []byte
+}
+
+func (g *NDJSONGenerator) Read(p []byte) (int, error) {
+	if len(g.rest) == 0 {
+		if g.Lines == 0 {
+			return 0, io.EOF
+		}
+		g.Lines--
+		g.rest = g.line
+	}
+
+	n := copy(p, g.rest)
+	g.rest = g.rest[n:]
+	return n, nil
+}
+
+func TestScanNDJSON(t *testing.T) {
+	line := []byte(`{"specversion":"1.0","id":"1","type":"t","source":"/s","data":"` + strings.Repeat("x", 1000) + `"}` + "\n")
+	g := &NDJSONGenerator{Lines: 50000, line: line}
+
+	var m runtime.MemStats
+	n := 0
+	err := ScanNDJSON(g, false, func(i int, j map[string]interface{}, order []string, _ error) {
+		if i != n || j["id"] != "1" {
+			t.Fatalf("Event %d was not scanned correctly: %+v", i, j)
+		}
+		n++
+
+		if n%10000 == 0 {
+			runtime.GC()
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc > 16<<20 {
+				t.Fatalf("Heap grew to %d bytes after %d events", m.HeapAlloc, n)
+			}
+		}
+	})
+
+	if err != nil || n != 50000 {
+		t.Errorf("Scanning returned %d events, %v", n, err)
+	}
+
+	if err := ScanNDJSON(strings.NewReader("{\"id\":\"1\"}\n\n[1]\n"), false, func(int, map[string]interface{}, []string, error) {}); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Invalid line was not reported: %v", err)
+	}
+}
+
+func TestMaxDataSize(t *testing.T) {
+	defer func(m int) { MaxDataSize = m }(MaxDataSize)
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"data":        strings.Repeat("x", 100),
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Data size should not be limited by default: %s", r)
+	}
+
+	MaxDataSize = 64
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != DataTooLarge || !strings.Contains(f[0].Message, "100 bytes, maximum is 64") {
+		t.Errorf("Oversized data was not reported: %+v", f)
+	}
+
+	j["data"] = map[string]interface{}{"a": 1}
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Small data should be valid: %s", r)
+	}
+
+	delete(j, "data")
+	j["data_base64"] = strings.Repeat("YQ==", 20)
+	if f := Verify(j); len(f) != 1 || f[0].Attribute != "data_base64" {
+		t.Errorf("Oversized data_base64 was not reported: %+v", f)
+	}
+}
+
+func TestAssertInvalid(t *testing.T) {
+	defer func(a bool) { AssertInvalid = a }(AssertInvalid)
+
+	AssertInvalid = false
+	if ExitStatus(true) != 0 || ExitStatus(false) != 1 {
+		t.Error("Exit status should only fail for invalid input by default")
+	}
+
+	AssertInvalid = true
+	if ExitStatus(true) != 1 || ExitStatus(false) != 0 {
+		t.Error("Exit status should only fail for valid input with -assert-invalid")
+	}
+
+	codes := FindingCodes(nil, Verify(map[string]interface{}{"specversion": "1.0", "id": "1", "type": "t"}))
+	codes = FindingCodes(codes, Verify(map[string]interface{}{"specversion": "1.0", "id": "1", "source": "/s"}))
+	if !reflect.DeepEqual(codes, []string{MissingRequired}) {
+		t.Errorf("Finding codes were %v", codes)
+	}
+
+	if s := AssertionSummary(codes); !strings.Contains(s, MissingRequired) {
+		t.Errorf("Summary does not name the findings that fired: %s", s)
+	}
+	if s := AssertionSummary(nil); !strings.Contains(s, "passed") {
+		t.Errorf("Summary does not report the unexpected pass: %s", s)
+	}
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.json")
+	headers := filepath.Join(dir, "headers.txt")
+	if err := ioutil.WriteFile(invalid, []byte(`{"specversion":"1.0","id":"1","type":"t"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(headers, []byte("ce-subject: s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := HandleFix(invalid); status != 0 {
+		t.Errorf("-fix of an invalid event should succeed with -assert-invalid, exited with %d", status)
+	}
+	if status := HandleMerge(headers, invalid); status != 0 {
+		t.Errorf("-merge of an invalid event should succeed with -assert-invalid, exited with %d", status)
+	}
+}
+
+func TestWrongVersion(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion":         "1.0",
+		"type":                "t",
+		"id":                  "1",
+		"source":              "/s",
+		"data":                "a",
+		"datacontentencoding": "base64",
+	}
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != WrongVersion || f[0].Attribute != "datacontentencoding" || !strings.Contains(f[0].Message, "belongs to 0.3") {
+		t.Errorf("`datacontentencoding` was not reported under 1.0: %+v", f)
+	}
+
+	j["specversion"] = "0.3"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("`datacontentencoding` should be valid under 0.3: %s", r)
+	}
+
+	j["dataschema"] = "https://example.com/schema"
+	if f := Verify(j); len(f) != 1 || f[0].Code != WrongVersion || f[0].Attribute != "dataschema" {
+		t.Errorf("`dataschema` was not reported under 0.3: %+v", f)
+	}
+
+	j["specversion"] = "0.4-wip"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Attributes of an unknown specversion should not be restricted: %s", r)
+	}
+
+	j = map[string]interface{}{
+		"specversion": "0.3",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"data_base64": "YQ==",
+	}
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != WrongVersion || f[0].Attribute != "data_base64" || !strings.Contains(f[0].Message, "specversion 0.3 (it belongs to 1.0)") {
+		t.Errorf("`data_base64` was not reported under 0.3: %+v", f)
+	}
+
+	j["specversion"] = "1.0"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("`data_base64` should be valid under 1.0: %s", r)
+	}
+}
+
+func TestStructuredContentTypes(t *testing.T) {
+	defer func(s []string) { StructuredContentTypes = s }(StructuredContentTypes)
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"0.4","type":"t","id":"1","source":"/s"}`))
+		req.Header.Add("content-type", "application/vnd.gateway+json")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post(); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("A custom content type should be binary mode by default (got %d): %s", rr.Code, rr.Body)
+	}
+
+	StructuredContentTypes = []string{"application/cloudevents", "application/vnd.gateway"}
+
+	if rr := post(); rr.Code != http.StatusOK {
+		t.Errorf("A custom structured content type was not accepted (got %d): %s", rr.Code, rr.Body)
+	}
+}
+
+func TestBinaryExtension(t *testing.T) {
+	defer func(r Rules) { LoadedRules = r }(LoadedRules)
+	LoadedRules = Rules{Extensions: map[string]string{"signature": "Binary"}}
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"signature":   "c2lnbmF0dXJl",
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Valid base64 should pass: %s", r)
+	}
+
+	j["signature"] = "not base64!"
+	if f := Verify(j); len(f) != 1 || f[0].Code != InvalidBase64 || f[0].Attribute != "signature" {
+		t.Errorf("Invalid base64 was not reported: %+v", f)
+	}
+}
+
+func TestVerifyFixtures(t *testing.T) {
+	results, err := VerifyFixtures(Fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, invalid := 0, 0
+	for _, r := range results {
+		if r.Valid != r.Expected {
+			t.Errorf("Fixture %s was not verified as expected (valid is %t)", r.Name, r.Valid)
+		}
+		if r.Expected {
+			valid++
+		} else {
+			invalid++
+		}
+	}
+
+	if valid == 0 || invalid == 0 {
+		t.Errorf("Fixtures should include valid and invalid events (got %d and %d)", valid, invalid)
+	}
+}
+
+func TestNoData(t *testing.T) {
+	defer func(r Rules) { LoadedRules = r }(LoadedRules)
+
+	j := map[string]interface{}{
+		"specversion":     "1.0",
+		"type":            "t",
+		"id":              "1",
+		"source":          "/s",
+		"datacontenttype": "application/vnd.example.ping; charset=utf-8",
+		"data":            "pong",
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Data should be allowed without rules: %s", r)
+	}
+
+	LoadedRules = Rules{NoData: []string{"Application/Vnd.Example.Ping"}}
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != DataNotAllowed {
+		t.Errorf("Data for a no-data content type was not reported: %+v", f)
+	}
+
+	delete(j, "data")
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("A no-data content type without data should be valid: %s", r)
+	}
+}
+
+func TestVerifyStreamJSONL(t *testing.T) {
+	defer func(o string) { Output = o }(Output)
+	Output = "jsonl"
+
+	input := `{"specversion":"1.0","id":"1","type":"t","source":"/s"}
+
+{"specversion":"1.0","id":"2","type":"t"}
+{"specversion":"1.0","type":"t","source":"/s3"}
+`
+
+	var out bytes.Buffer
+	codes, n, err := VerifyStream(context.Background(), strings.NewReader(input), &out, false)
+	if err != nil || n != 3 || !reflect.DeepEqual(codes, []string{MissingRequired}) {
+		t.Fatalf("Verifying the stream returned %v, %d, %v", codes, n, err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected one line per event, got:\n%s", out.String())
+	}
+
+	expected := []struct {
+		ID     string
+		Source string
+		Valid  bool
+	}{
+		{"1", "/s", true},
+		{"2", "", false},
+		{"", "/s3", false},
+	}
+
+	for i, line := range lines {
+		var r LineResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Line %d is not JSON: %s\n%s", i, err, line)
+		}
+		if r.ID != expected[i].ID || r.Source != expected[i].Source || r.Valid != expected[i].Valid || r.Valid != (len(r.Findings) == 0) {
+			t.Errorf("Line %d is not the expected result: %s", i, line)
+		}
+	}
+}
+
+func TestParsedTime(t *testing.T) {
+	a, ok := ParsedTime(map[string]interface{}{"time": "2018-04-05T17:31:00Z"})
+	if !ok {
+		t.Fatal("The `Z` form was not parsed")
+	}
+
+	b, ok := ParsedTime(map[string]interface{}{"time": "2018-04-05T19:31:00+02:00"})
+	if !ok {
+		t.Fatal("The offset form was not parsed")
+	}
+
+	if !a.Equal(b) {
+		t.Errorf("%s and %s should be the same instant", a, b)
+	}
+
+	for _, j := range []map[string]interface{}{
+		{},
+		{"time": nil},
+		{"time": 5},
+		{"time": "2018-04-05 17:31:00"},
+	} {
+		if _, ok := ParsedTime(j); ok {
+			t.Errorf("Time of %+v should not be parsed", j)
+		}
+	}
+}
+
+func TestEnvelopeSchema(t *testing.T) {
+	defer func(s interface{}) { EnvelopeSchema = s }(EnvelopeSchema)
+
+	var err error
+	if EnvelopeSchema, err = LoadSchema("bundled"); err != nil {
+		t.Fatal(err)
+	}
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"time":        "2018-04-05T17:31:00Z",
+		"data":        map[string]interface{}{"a": 1.0},
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("A valid event should match the bundled schema: %s", r)
+	}
+
+	j["subject"] = ""
+
+	reported := false
+	for _, f := range Verify(j) {
+		reported = reported || (f.Code == SchemaViolation && f.Attribute == "subject")
+	}
+	if !reported {
+		t.Errorf("Empty subject was not reported by the schema")
+	}
+
+	delete(j, "subject")
+	delete(j, "id")
+
+	codes := map[string]bool{}
+	for _, f := range Verify(j) {
+		if f.Attribute != "id" {
+			t.Errorf("Unexpected finding %+v", f)
+		}
+		codes[f.Code] = true
+	}
+	if !codes[SchemaViolation] || !codes[MissingRequired] {
+		t.Errorf("Missing `id` should be reported by the schema and the built-in checks: %v", codes)
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "integer", "maximum": 10.0},
+		"properties": map[string]interface{}{
+			"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"enum": []interface{}{"a", "b"}}},
+		},
+	}
+
+	errs := SchemaErrors(context.Background(), schema, schema, map[string]interface{}{"n": 11.0, "m": 1.5, "tags": []interface{}{"a", "c"}}, "")
+	expected := []SchemaError{
+		{"/m", "is not of type number", "m"},
+		{"/n", "is greater than 10", "n"},
+		{"/tags/1", "is not one of the allowed values", "tags"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Schema errors were %+v, expected %+v", errs, expected)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	for _, test := range []struct {
+		Schema string
+		Error  string
+	}{
+		{`{"$ref": "#/definitions/a", "definitions": {"a": {"type": "string"}}}`, ""},
+		{`{"properties": {"next": {"$ref": "#"}}}`, ""},
+		{`{"$ref": "#"}`, `the $ref "#" leads back to itself without descending into the value`},
+		{`{"allOf": [{"$ref": "#/definitions/b"}], "definitions": {"a": {"$ref": "#"}, "b": {"anyOf": [{"$ref": "#/definitions/a"}]}}}`, `the $ref "#" leads back to itself without descending into the value`},
+		{`{"$ref": "#/definitions/missing"}`, `"#" has the $ref "#/definitions/missing": JSON pointer "/definitions/missing" does not resolve (no member "definitions")`},
+		{`{"$ref": "other.json"}`, `"#" has the unsupported $ref "other.json" (only local ones are)`},
+		{`{"properties": {"id": {"patternProperties": {}}}}`, `"#/properties/id" has the unsupported keyword "patternProperties"`},
+		{`{"if": {"type": "string"}, "then": false}`, `"#" has the unsupported keyword "if"`},
+		{`{"items": [1]}`, `"#/items/0" is not a schema (an object or a boolean)`},
+	} {
+		var schema interface{}
+		if err := json.Unmarshal([]byte(test.Schema), &schema); err != nil {
+			t.Fatal(err)
+		}
+
+		err := CheckSchema(schema)
+		if (err == nil && test.Error != "") || (err != nil && err.Error() != test.Error) {
+			t.Errorf("Checking %s gave %v, expected %q", test.Schema, err, test.Error)
+		}
+	}
+
+	var registry Registry
+	json.Unmarshal([]byte(`{"types": {"t": {"schema": {"$ref": "#"}}}}`), &registry)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(registry)
+	}))
+	defer srv.Close()
+
+	if _, err := LoadRegistry(srv.URL); err == nil || !strings.Contains(err.Error(), `schema of "t"`) {
+		t.Errorf("A registry with a cyclic schema should not load: %v", err)
+	}
+
+	schema := map[string]interface{}{
+		"oneOf": []interface{}{true, true, true},
+		"properties": map[string]interface{}{
+			"tags": map[string]interface{}{"minItems": 3.0, "uniqueItems": true},
+			"n":    map[string]interface{}{"exclusiveMaximum": 10.0},
+		},
+	}
+	errs := SchemaErrors(context.Background(), schema, schema, map[string]interface{}{"n": 10.0, "tags": []interface{}{"a", "a"}}, "")
+	expected := []SchemaError{
+		{"", "matches more than one of oneOf", ""},
+		{"/n", "is not less than 10", "n"},
+		{"/tags", "has fewer than 3 items", "tags"},
+		{"/tags", "has the items 0 and 1 equal", "tags"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Schema errors were %+v, expected %+v", errs, expected)
+	}
+}
+
+func TestBinaryData(t *testing.T) {
+	defer func(s interface{}) { EnvelopeSchema = s }(EnvelopeSchema)
+	EnvelopeSchema, _ = LoadSchema("bundled")
+
+	body := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, 0x80}
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	req.Header.Add("content-type", "image/png")
+	req.Header.Add("ce-specversion", "1.0")
+	req.Header.Add("ce-type", "t")
+	req.Header.Add("ce-id", "1")
+	req.Header.Add("ce-source", "/s")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Binary data should be valid (got %d): %s", rr.Code, rr.Body)
+	}
+
+	j, _, _ := BinaryAttributes(req.Header, body)
+	if !bytes.Equal(j["data"].([]byte), body) {
+		t.Errorf("Binary data was changed to %v", j["data"])
+	}
+
+	e := StructuredEvent(j)
+	if decoded, err := base64.StdEncoding.DecodeString(e["data_base64"].(string)); err != nil || !bytes.Equal(decoded, body) || e["data"] != nil {
+		t.Errorf("Binary data was not moved to data_base64: %+v", e)
+	}
+}
+
+func TestRequireTLS(t *testing.T) {
+	defer func(r bool) { RequireTLS = r }(RequireTLS)
+
+	RequireTLS = false
+	if err := CheckTLS("", ""); err != nil {
+		t.Errorf("Plain HTTP should be allowed by default: %s", err)
+	}
+
+	RequireTLS = true
+	if err := CheckTLS("", ""); err != ErrTLSRequired {
+		t.Errorf("Plain HTTP should be refused with -require-tls: %v", err)
+	}
+	if err := CheckTLS("server.crt", ""); err != ErrTLSRequired {
+		t.Errorf("A certificate without key should be refused with -require-tls: %v", err)
+	}
+	if err := CheckTLS("server.crt", "server.key"); err != nil {
+		t.Errorf("TLS should be allowed with -require-tls: %s", err)
+	}
+}
+
+func TestDuplicateIdentities(t *testing.T) {
+	events := []map[string]interface{}{
+		{"source": "/s", "id": "1"},
+		{"source": "/s", "id": "2"},
+		{"source": "/other", "id": "1"},
+		{"source": "/s", "id": "1"},
+		{"source": "/s", "id": "1"},
+		{"id": "2"},
+		{"source": "/s", "id": "2"},
+	}
+
+	expected := []EventIdentity{{"/s", "1"}, {"/s", "2"}}
+	if d := DuplicateIdentities(events); !reflect.DeepEqual(d, expected) {
+		t.Errorf("Duplicate identities were %+v, expected %+v", d, expected)
+	}
+
+	if d := DuplicateIdentities(events[:3]); len(d) != 0 {
+		t.Errorf("Events with unique identities were reported as duplicates: %+v", d)
+	}
+}
+
+func TestFilePattern(t *testing.T) {
+	defer func(p string) { FilePattern = p }(FilePattern)
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "nested"), 0755)
+
+	for _, name := range []string{"a.event.json", "b.json", "d.YAML", "e.ndjson", "notes.txt", filepath.Join("nested", "c.event.json")} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(`{"id": "1"}`), 0644)
+	}
+
+	for _, test := range []struct {
+		Pattern string
+		Files   []string
+	}{
+		{"", []string{"a.event.json", "b.json", "d.YAML", "e.ndjson", filepath.Join("nested", "c.event.json")}},
+		{"*.json", []string{"a.event.json", "b.json", filepath.Join("nested", "c.event.json")}},
+		{"*.event.json", []string{"a.event.json", filepath.Join("nested", "c.event.json")}},
+	} {
+		FilePattern = test.Pattern
+
+		files, err := DirectoryFiles(dir)
+		for i := range test.Files {
+			test.Files[i] = filepath.Join(dir, test.Files[i])
+		}
+		if err != nil || !reflect.DeepEqual(files, test.Files) {
+			t.Errorf("Pattern %q matched %v, %v", test.Pattern, files, err)
+		}
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	defer func(s bool) { Strict = s }(Strict)
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"contenttype": "application/json",
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("A reserved extension name should only be flagged in strict mode: %s", r)
+	}
+
+	Strict = true
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != ReservedName || f[0].Attribute != "contenttype" || !strings.Contains(f[0].Message, "`ce-contenttype`") {
+		t.Errorf("A reserved extension name was not flagged in strict mode: %+v", f)
+	}
+
+	delete(j, "contenttype")
+	j["host"] = "example.com"
+
+	if f := Verify(j); len(f) != 1 || f[0].Code != ReservedName || f[0].Attribute != "host" || !strings.Contains(f[0].Message, "standard HTTP header") {
+		t.Errorf("An extension named like an HTTP header was not flagged in strict mode: %+v", f)
+	}
+
+	delete(j, "host")
+
+	for _, c := range []struct {
+		version, name, value string
+	}{
+		{"1.0", "schemaurl", "https://example.com/schema"},
+		{"1.0", "datacontentencoding", "base64"},
+		{"0.3", "dataschema", "https://example.com/schema"},
+	} {
+		e := map[string]interface{}{"specversion": c.version, "type": "t", "id": "1", "source": "/s", c.name: c.value}
+		if codes := FindingCodes(nil, Verify(e)); !reflect.DeepEqual(codes, []string{WrongVersion, ReservedName}) {
+			t.Errorf("`%s` in a %s event should be reported as reserved and of the wrong version, got %v", c.name, c.version, codes)
+		}
+	}
+
+	j["comexampleid"] = "abc"
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("An ordinary extension name should be valid in strict mode: %s", r)
+	}
+}
+
+func TestNoExit(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	ioutil.WriteFile(valid, []byte(`{"specversion":"1.0","id":"1","type":"t","source":"/s"}`), 0644)
+	ioutil.WriteFile(invalid, []byte(`{"specversion":"1.0","id":"1"}`), 0644)
+
+	for i := 0; i < 2; i++ {
+		if status := HandleFile(invalid); status != 1 {
+			t.Errorf("Invalid file returned status %d", status)
+		}
+		if status := HandleFile(valid); status != 0 {
+			t.Errorf("Valid file returned status %d", status)
+		}
+	}
+
+	if status := HandleFile(filepath.Join(dir, "missing.json")); status != 1 {
+		t.Errorf("Missing file returned status %d", status)
+	}
+	if status := HandleDirectory(dir); status != 1 {
+		t.Errorf("Directory with an invalid file returned status %d", status)
+	}
+}
+
+func TestStructuredFormat(t *testing.T) {
+	for _, test := range []struct {
+		ContentType string
+		Code        int
+	}{
+		{"application/cloudevents", http.StatusUnsupportedMediaType},
+		{"application/cloudevents+xml", http.StatusUnsupportedMediaType},
+		{"application/cloudevents+json", http.StatusOK},
+		{"application/cloudevents+json; charset=utf-8", http.StatusOK},
+	} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"1.0","type":"t","id":"1","source":"/s"}`))
+		req.Header.Add("content-type", test.ContentType)
+		req.Header.Add("accept", "application/json")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+		if rr.Code != test.Code {
+			t.Errorf("Content-Type %q returned %d instead of %d: %s", test.ContentType, rr.Code, test.Code, rr.Body)
+		}
+
+		var result Result
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		if test.Code != http.StatusOK && (len(result.Findings) != 1 || result.Findings[0].Code != UnsupportedFormat) {
+			t.Errorf("Content-Type %q was not reported as unsupported: %s", test.ContentType, rr.Body)
+		}
+	}
+
+	defer func(s []string) { StructuredContentTypes = s }(StructuredContentTypes)
+	StructuredContentTypes = []string{"application/cloudevents", "application/json"}
+
+	for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "application/cloudevents+json"} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"1.0","type":"t","id":"1","source":"/s"}`))
+		req.Header.Add("content-type", contentType)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Content-Type %q in -structured-content-types returned %d: %s", contentType, rr.Code, rr.Body)
+		}
+	}
+}
+
+func TestReportPassing(t *testing.T) {
+	defer func(r bool) { ReportPassing = r }(ReportPassing)
+
+	events := []map[string]interface{}{
+		{"specversion": "1.0", "id": "1", "type": "t", "source": "/s", "time": "yesterday", "data": "x"},
+	}
+
+	if r := NewBatchResult(context.Background(), events, nil); r.Events[0].Passed != nil {
+		t.Errorf("Passing attributes should not be reported by default: %v", r.Events[0].Passed)
+	}
+
+	ReportPassing = true
+
+	r := NewBatchResult(context.Background(), events, nil)
+	if !reflect.DeepEqual(r.Events[0].Passed, []string{"id", "source", "specversion", "type"}) {
+		t.Errorf("Passing attributes were %v", r.Events[0].Passed)
+	}
+
+	var out bytes.Buffer
+	WriteReport(&out, r, false)
+	if !strings.Contains(out.String(), "Attribute `id` passed\n") || !strings.Contains(out.String(), "Attribute `time` is not a valid Timestamp") {
+		t.Errorf("Text report is missing the passing attributes:\n%s", out.String())
+	}
+
+	b, _ := json.Marshal(r.Events[0])
+	if !strings.Contains(string(b), `"passed":["id","source","specversion","type"]`) {
+		t.Errorf("JSON result is missing the passing attributes: %s", b)
+	}
+}
+
+func TestURNSource(t *testing.T) {
+	for _, test := range []struct {
+		Source string
+		Pass   bool
+	}{
+		{"urn:example:foo", true},
+		{"URN:example:foo/bar:baz", true},
+		{"urn:ietf:rfc:8141?+res?=q#f", true},
+		{"urn:uuid:6e8bc430-9c3a-11d9-9669-0800200c9a66", true},
+		{"urn:", false},
+		{"urn:example", false},
+		{"urn:example:", false},
+		{"urn:-example:foo", false},
+		{"urn:e:foo", false},
+		{"urn:example:foo?query", false},
+		{"urn:example:a%2Fb", true},
+	} {
+		j := map[string]interface{}{
+			"specversion": "1.0",
+			"type":        "t",
+			"id":          "1",
+			"source":      test.Source,
+		}
+
+		f := Verify(j)
+		if test.Pass && len(f) != 0 {
+			t.Errorf("URN %q should be valid: %+v", test.Source, f)
+		} else if !test.Pass && (len(f) != 1 || f[0].Code != InvalidURN) {
+			t.Errorf("URN %q should be reported as invalid: %+v", test.Source, f)
+		}
+	}
+
+	// Verify reports these as invalid URIs before CheckURN sees them
+	for _, source := range []string{"urn:example:a%2", "urn:example:a%zzb", "urn:example:100%"} {
+		if f := CheckURN(map[string]interface{}{"source": source}, "source"); f == nil || f.Code != InvalidURN {
+			t.Errorf("URN %q with a malformed percent-encoding should be reported as invalid: %+v", source, f)
+		}
+	}
+}
+
+func TestVerifyVersions(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"dataschema":  "https://example.com/schema",
+	}
+
+	results := VerifyVersions(j, SpecVersions)
+	if len(results) != 2 || results[0].Version != "0.3" || results[1].Version != "1.0" {
+		t.Fatalf("Unexpected version results %+v", results)
+	}
+
+	if results[0].Valid || results[0].Findings[0].Code != WrongVersion {
+		t.Errorf("Event with `dataschema` should be invalid under 0.3: %+v", results[0])
+	}
+	if !results[1].Valid {
+		t.Errorf("Event should be valid under 1.0: %+v", results[1])
+	}
+	if j["specversion"] != "1.0" {
+		t.Errorf("The event was changed: %+v", j)
+	}
+}
+
+func TestBinaryWithoutBody(t *testing.T) {
+	defer func(e bool) { EchoAttributes = e }(EchoAttributes)
+	EchoAttributes = true
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(""))
+	req.Header.Add("content-type", "text/plain")
+	req.Header.Add("accept", "application/json")
+	req.Header.Add("ce-specversion", "1.0")
+	req.Header.Add("ce-type", "t")
+	req.Header.Add("ce-id", "1")
+	req.Header.Add("ce-source", "/s")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(HandleServer).ServeHTTP(rr, req)
+
+	var result Result
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Server did not return JSON: %s\n%s", err, rr.Body)
+	}
+
+	if rr.Code != http.StatusOK || !result.Valid {
+		t.Errorf("Binary event without body should be valid (got %d): %s", rr.Code, rr.Body)
+	}
+
+	if _, ok := result.Attributes["datacontenttype"]; ok {
+		t.Errorf("Content-Type should not become datacontenttype without a body: %s", rr.Body)
+	}
+
+	j, provenance, _ := BinaryAttributes(req.Header, nil)
+	if _, ok := j["data"]; ok || provenance["datacontenttype"] != "" {
+		t.Errorf("Binary event without body should have no data: %+v, %+v", j, provenance)
+	}
+
+	j, _, _ = BinaryAttributes(req.Header, []byte("a"))
+	if j["datacontenttype"] != "text/plain" {
+		t.Errorf("Content-Type should become datacontenttype with a body: %+v", j)
+	}
+}
+
+func TestMissingHost(t *testing.T) {
+	for _, test := range []struct {
+		URI  string
+		Pass bool
+	}{
+		{"http:///path", false},
+		{"https://:8080/path", false},
+		{"https://host/path", true},
+		{"urn:example:schema", true},
+		{"mailto:someone@example.com", true},
+	} {
+		j := map[string]interface{}{
+			"specversion": "1.0",
+			"type":        "t",
+			"id":          "1",
+			"source":      "/s",
+			"dataschema":  test.URI,
+		}
+
+		f := Verify(j)
+		if test.Pass && len(f) != 0 {
+			t.Errorf("URI %q should be valid: %+v", test.URI, f)
+		} else if !test.Pass && (len(f) != 1 || f[0].Code != MissingHost) {
+			t.Errorf("URI %q should be reported without host: %+v", test.URI, f)
+		}
+	}
+}
+
+func TestJSONIndent(t *testing.T) {
+	defer func(i string) { JSONIndent = i }(JSONIndent)
+
+	j := map[string]interface{}{"id": "1"}
+
+	for _, test := range []struct {
+		Indent   string
+		Expected string
+	}{
+		{"2", "{\n  \"id\": \"1\"\n}"},
+		{"4", "{\n    \"id\": \"1\"\n}"},
+		{"tab", "{\n\t\"id\": \"1\"\n}"},
+	} {
+		var err error
+		if JSONIndent, err = ParseIndent(test.Indent); err != nil {
+			t.Fatal(err)
+		}
+
+		if b, _ := MarshalEvent(j); string(b) != test.Expected {
+			t.Errorf("Indent %q gave %q instead of %q", test.Indent, b, test.Expected)
+		}
+	}
+
+	for _, indent := range []string{"-1", "two", "100"} {
+		if _, err := ParseIndent(indent); err == nil {
+			t.Errorf("Indent %q should be invalid", indent)
+		}
+	}
+}
+
+func TestIntegerRange(t *testing.T) {
+	defer func(r Rules) { LoadedRules = r }(LoadedRules)
+	LoadedRules = Rules{Extensions: map[string]string{"attempt": "Integer"}}
+
+	for _, test := range []struct {
+		Value interface{}
+		Code  string
+	}{
+		{2147483647.0, ""},
+		{-2147483648.0, ""},
+		{2147483648.0, OutOfRange},
+		{-2147483649.0, OutOfRange},
+		{json.Number("2147483647"), ""},
+		{json.Number("9223372036854775807"), OutOfRange},
+		{json.Number("1.5"), WrongType},
+		{json.Number("1.0"), WrongType},
+		{json.Number("1e3"), WrongType},
+		{json.Number("4294967296"), OutOfRange},
+		{json.Number("-5"), ""},
+		{"-5", WrongType},
+	} {
+		j := map[string]interface{}{
+			"specversion": "1.0",
+			"type":        "t",
+			"id":          "1",
+			"source":      "/s",
+			"attempt":     test.Value,
+		}
+
+		f := Verify(j)
+		if test.Code == "" && len(f) != 0 {
+			t.Errorf("Integer %v should be valid: %+v", test.Value, f)
+		} else if test.Code != "" && (len(f) != 1 || f[0].Code != test.Code) {
+			t.Errorf("Integer %v should be reported as %s: %+v", test.Value, test.Code, f)
+		}
+	}
+
+	// every input keeps the text of a number
+	dir := t.TempDir()
+	for _, test := range []struct {
+		Attempt string
+		Status  int
+	}{
+		{"3", 0},
+		{"1.0", 1},
+		{"1e3", 1},
+	} {
+		event := `{"specversion":"1.0","type":"t","id":"1","source":"/s","attempt":` + test.Attempt + `}`
+		file := filepath.Join(dir, "event.json")
+		if err := ioutil.WriteFile(file, []byte(event), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if status := HandleFile(file); status != test.Status {
+			t.Errorf("A file with the Integer %s should exit with %d, got %d", test.Attempt, test.Status, status)
+		}
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/", strings.NewReader(event))
+		req.Header.Set("Content-Type", "application/cloudevents+json")
+		HandleServer(rr, req)
+		if (rr.Code == http.StatusOK) != (test.Status == 0) {
+			t.Errorf("A structured request with the Integer %s was answered with %d", test.Attempt, rr.Code)
+		}
+	}
+}
+
+func TestPipe(t *testing.T) {
+	valid := `{"specversion":"1.0","type":"t","id":"1","source":"/s"}`
+	in := strings.Join([]string{
+		valid,
+		`{"specversion":"1.0","type":"t","source":"/s"}`,
+		"",
+		"not json",
+		`{"specversion":"1.0", "type":"t", "id":"2", "source":"/s"}`,
+	}, "\n")
+
+	var out, log bytes.Buffer
+	dropped, err := Pipe(strings.NewReader(in), &out, &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dropped != 2 {
+		t.Errorf("Pipe should have dropped 2 lines, dropped %d", dropped)
+	}
+
+	if expected := valid + "\n" + `{"specversion":"1.0", "type":"t", "id":"2", "source":"/s"}` + "\n"; out.String() != expected {
+		t.Errorf("Pipe should pass the valid lines through unchanged, got %q", out.String())
+	}
+
+	if !strings.Contains(log.String(), "Line 2 dropped") || !strings.Contains(log.String(), "Line 4 dropped") {
+		t.Errorf("Pipe should log the dropped lines, got %q", log.String())
+	}
+	out.Reset()
+	if dropped, err := Pipe(strings.NewReader(string(BOM)+valid), &out, &log); err != nil || dropped != 0 || out.String() != valid+"\n" {
+		t.Errorf("Pipe should pass a first line with a BOM without it, got %q (%d dropped, %v)", out.String(), dropped, err)
+	}
+}
+
+func TestSubjectWithData(t *testing.T) {
+	defer func(s bool, n int) { Strict, SubjectDataSize = s, n }(Strict, SubjectDataSize)
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"data":        strings.Repeat("x", 100),
+	}
+
+	Strict = true
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Large data without subject should only be reported with -subject-data-size: %s", r)
+	}
+
+	SubjectDataSize = 64
+	Strict = false
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Large data without subject should only be reported in strict mode: %s", r)
+	}
+
+	Strict = true
+	if f := Verify(j); len(f) != 1 || f[0].Code != MissingSubject || f[0].Attribute != "subject" {
+		t.Errorf("Large data without subject was not reported: %+v", f)
+	}
+
+	j["subject"] = "s"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Large data with subject should be valid: %s", r)
+	}
+
+	delete(j, "data")
+	delete(j, "subject")
+	j["data_base64"] = "YQ=="
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Small data without subject should be valid: %s", r)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	defer func(c map[string]string) { Catalog = c }(Catalog)
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"source":      "/s",
+	}
+
+	var err error
+	if Catalog, err = LoadLocale("en"); err != nil || Catalog != nil {
+		t.Fatalf("English should be the built-in messages: %v", err)
+	}
+	if f := Verify(j); len(f) != 1 || f[0].Message != "Attribute `id` is missing." {
+		t.Errorf("Message should be in English: %+v", f)
+	}
+
+	if Catalog, err = LoadLocale("de"); err != nil {
+		t.Fatal(err)
+	}
+	if f := Verify(j); len(f) != 1 || f[0].Code != MissingRequired || f[0].Message != "Das Attribut `id` fehlt" {
+		t.Errorf("Message should be in German: %+v", f)
+	}
+
+	if _, err := LoadLocale("xx"); err == nil || !strings.Contains(err.Error(), "de, en") {
+		t.Errorf("An unknown locale should fail naming the known ones: %v", err)
+	}
+}
+
+// codeConstants are the values of the finding code constants declared in main.go.
+func codeConstants(t *testing.T) []string {
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range file.Decls {
+		d, ok := d.(*ast.GenDecl)
+		if !ok || d.Tok != token.CONST || d.Specs[0].(*ast.ValueSpec).Names[0].Name != "MissingRequired" {
+			continue
+		}
+
+		var codes []string
+		for _, spec := range d.Specs {
+			code, _ := strconv.Unquote(spec.(*ast.ValueSpec).Values[0].(*ast.BasicLit).Value)
+			codes = append(codes, code)
+		}
+		return codes
+	}
+
+	t.Fatal("The finding codes were not found in main.go")
+	return nil
+}
+
+func TestLocaleCoverage(t *testing.T) {
+	codes := codeConstants(t)
+
+	for _, locale := range KnownLocales() {
+		catalog, err := LoadLocale(locale)
+		if err != nil {
+			t.Fatal(err)
+		} else if catalog == nil {
+			continue
+		}
+
+		for _, code := range codes {
+			if _, ok := catalog[code]; !ok {
+				t.Errorf("Locale %s has no message for %s", locale, code)
+			}
+		}
+		for code := range catalog {
+			if !StringInSlice(code, codes) {
+				t.Errorf("Locale %s has a message for the unknown code %s", locale, code)
+			}
+		}
+	}
+}
+
+func TestServerHead(t *testing.T) {
+	get := httptest.NewRecorder()
+	HandleServer(get, httptest.NewRequest("GET", "/", nil))
+
+	head := httptest.NewRecorder()
+	HandleServer(head, httptest.NewRequest("HEAD", "/", nil))
+
+	if head.Body.Len() != 0 {
+		t.Errorf("HEAD should not return a body, got %q", head.Body.String())
+	}
+
+	if get.Body.Len() == 0 || head.Code != get.Code {
+		t.Errorf("HEAD should return the status of GET (%d), got %d", get.Code, head.Code)
+	}
+
+	for _, k := range []string{"Content-Type", "Content-Length"} {
+		if head.Header().Get(k) != get.Header().Get(k) || get.Header().Get(k) == "" {
+			t.Errorf("HEAD should return the %s of GET (%q), got %q", k, get.Header().Get(k), head.Header().Get(k))
+		}
+	}
+}
+
+func TestContextTimeout(t *testing.T) {
+	defer func(s interface{}, d time.Duration) { EnvelopeSchema, EventTimeout = s, d }(EnvelopeSchema, EventTimeout)
+
+	// every level tries both failing branches, so matching takes 2^40 steps
+	var schema interface{} = map[string]interface{}{"type": "number"}
+	for i := 0; i < 40; i++ {
+		schema = map[string]interface{}{"anyOf": []interface{}{schema, schema}}
+	}
+	EnvelopeSchema = map[string]interface{}{"properties": map[string]interface{}{"id": schema}}
+	EventTimeout = 20 * time.Millisecond
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+	}
+
+	start := time.Now()
+	f := Verify(j)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Verification should have been cancelled after %s, took %s", EventTimeout, elapsed)
+	}
+
+	if len(f) != 1 || f[0].Code != Timeout {
+		t.Errorf("The cancelled schema check should be reported as a timeout: %+v", f)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if f := VerifyContext(ctx, j); len(f) != 1 || f[0].Code != Timeout {
+		t.Errorf("A cancelled context should be reported as a timeout: %+v", f)
+	}
+
+	// the batch, the stream and the server give up with their context
+	result := NewBatchResult(ctx, []map[string]interface{}{j}, nil)
+	if len(result.Findings) != 1 || result.Findings[0].Code != Timeout || result.Events[0].Findings[0].Code != Timeout {
+		t.Errorf("A cancelled batch should be reported as a timeout: %+v", result)
+	}
+
+	var out bytes.Buffer
+	if _, n, err := VerifyStream(ctx, strings.NewReader(`{"specversion":"1.0","type":"t","id":"1","source":"/s"}`), &out, false); err != context.Canceled || n != 0 {
+		t.Errorf("A cancelled stream should stop with the error of its context, got %d events and %v", n, err)
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"1.0","type":"t","id":"1","source":"/s"}`)).WithContext(ctx)
+	req.Header.Add("Content-Type", "application/cloudevents+json")
+	req.Header.Add("Accept", "application/json")
+
+	rr := httptest.NewRecorder()
+	HandleServer(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), Timeout) {
+		t.Errorf("A cancelled request should be reported as a timeout, got %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestNonASCII(t *testing.T) {
+	defer func(s bool) { Strict = s }(Strict)
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"subject":     "café",
+		"data":        "ünicode data is fine",
+	}
+
+	Strict = false
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Non-ASCII values should only be reported in strict mode: %s", r)
+	}
+
+	Strict = true
+	if f := Verify(j); len(f) != 1 || f[0].Code != NonASCII || f[0].Attribute != "subject" || !strings.Contains(f[0].Message, "'é' (U+00E9)") {
+		t.Errorf("Non-ASCII subject was not reported: %+v", f)
+	}
+
+	j["subject"] = "cafe"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("ASCII values should be valid: %s", r)
+	}
+}
+
+func TestCanonicalOrder(t *testing.T) {
+	defer func(c bool) { CanonicalOrder = c }(CanonicalOrder)
+
+	shuffled := []byte(`{"id":"1","specversion":"1.0","source":"/s","type":"t","data":"a","ext":"b"}`)
+	j, err := ParseEvent(shuffled, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CanonicalOrder = false
+	if f := VerifyOrdered(context.Background(), j, EventOrder(shuffled, "")); len(f) != 0 {
+		t.Errorf("The order should only be checked with -canonical-order: %+v", f)
+	}
+
+	CanonicalOrder = true
+	order := EventOrder(shuffled, "")
+	for i := 0; i < 2; i++ {
+		if f := VerifyOrdered(context.Background(), j, order); len(f) != 1 || f[0].Code != OutOfOrder || f[0].Attribute != "specversion" || !strings.Contains(f[0].Message, "after `id`") {
+			t.Errorf("The first out-of-order attribute was not reported by verification %d: %+v", i, f)
+		}
+	}
+
+	batch := []byte(`[{"specversion":"1.0","id":"1","source":"/s","type":"t","ext":"b","data":"a"},` +
+		`{"specversion":"1.0","id":"1","source":"/s","type":"t","data":"a","ext":"b"}]`)
+	events, _, err := ParseEvents(batch, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := NewBatchResult(context.Background(), events, InputOrders(batch, "json"))
+	if !result.Events[0].Valid {
+		t.Errorf("A canonically ordered event should be valid: %+v", result.Events[0].Findings)
+	}
+	if f := result.Events[1].Findings; len(f) != 1 || f[0].Attribute != "ext" {
+		t.Errorf("An extension after data was not reported: %+v", f)
+	}
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(shuffled))
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	rr := httptest.NewRecorder()
+	HandleServer(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "`specversion` comes after `id`") {
+		t.Errorf("The server should check the order too: %d %s", rr.Code, rr.Body)
+	}
+}
+
+func BenchmarkVerifyJSONValid(b *testing.B) {
+	events := make([]map[string]interface{}, 1000)
+	for i := range events {
+		events[i] = map[string]interface{}{
+			"specversion":     "1.0",
+			"type":            "com.example.someevent",
+			"id":              strconv.Itoa(i),
+			"source":          "https://example.com/source",
+			"subject":         "subject",
+			"time":            "2018-04-05T17:31:00Z",
+			"datacontenttype": "application/json",
+			"dataschema":      "https://example.com/schema",
+			"comexampleext":   "value",
+			"data":            map[string]interface{}{"a": 1.0},
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if r := VerifyJSON(events[i%len(events)]); r != "" {
+			b.Fatal(r)
+		}
+	}
+}
+
+func TestBOM(t *testing.T) {
+	event := `{"specversion":"1.0","type":"t","id":"1","source":"/s"}`
+
+	for _, format := range []string{"json", "yaml", "ndjson"} {
+		events, _, err := ParseInput(strings.NewReader("\xef\xbb\xbf"+event), format, false)
+		if err != nil {
+			t.Errorf("A BOM-prefixed %s event should be parsed: %s", format, err)
+		} else if r := VerifyJSON(events[0]); r != "" {
+			t.Errorf("A BOM-prefixed %s event should be valid: %s", format, r)
+		}
+	}
+
+	err := ScanNDJSON(strings.NewReader("\xef\xbb\xbf"+event+"\n"+event), false, func(i int, j map[string]interface{}, order []string, _ error) {
+		if r := VerifyJSON(j); r != "" {
+			t.Errorf("Event %d of a BOM-prefixed stream should be valid: %s", i, r)
+		}
+	})
+	if err != nil {
+		t.Errorf("A BOM-prefixed stream should be parsed: %s", err)
+	}
+}
+
+func TestCompareToServer(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"source":      "/s",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(HandleServer))
+	defer server.Close()
+
+	remote, err := VerifyRemote(server.URL, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := CompareFindings(Verify(j), remote); !c.Agree {
+		t.Errorf("The same version should agree: %+v", c)
+	}
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("The server should be asked for JSON, got %q", r.Header.Get("Accept"))
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"valid":false,"findings":[{"code":"missing_required","attribute":"id","message":"Attribute id is missing"},{"code":"too_long","attribute":"source","message":"too long"}]}`))
+	}))
+	defer stub.Close()
+
+	if remote, err = VerifyRemote(stub.URL, j); err != nil {
+		t.Fatal(err)
+	}
+	c := CompareFindings(Verify(j), remote)
+	if c.Agree || len(c.Local) != 0 || len(c.Remote) != 1 || c.Remote[0].Code != TooLong {
+		t.Errorf("Only the stub's extra finding should disagree: %+v", c)
+	}
+
+	defer func(m int64) { MaxBodySize = m }(MaxBodySize)
+	MaxBodySize = 16
+
+	if _, err := VerifyRemote(stub.URL, j); err != ErrBodyTooLarge {
+		t.Errorf("A response larger than -max-body-size should be rejected, got %v", err)
+	}
+}
+
+func TestNonStringSpecVersion(t *testing.T) {
+	for _, v := range []interface{}{1.0, 0.3, json.Number("1.0"), map[string]interface{}{"major": 1.0}} {
+		j := map[string]interface{}{
+			"specversion":         v,
+			"type":                "t",
+			"id":                  "1",
+			"source":              "/s",
+			"data":                "YQ==",
+			"datacontentencoding": "base64",
+			"dataschema":          "https://example.com/schema",
+		}
+
+		f := Verify(j)
+		if len(f) != 1 || f[0].Code != WrongType || f[0].Attribute != "specversion" || !strings.Contains(f[0].Message, "checks that depend on the specversion were skipped") {
+			t.Errorf("Only the type of specversion %v should be reported: %+v", v, f)
+		}
+	}
+
+	j := map[string]interface{}{"specversion": 1.0, "type": "t", "id": "1", "source": "/s"}
+	if f := Verify(j); len(f) != 1 || !strings.Contains(f[0].Message, `quote it as "1.0"`) {
+		t.Errorf("A numeric specversion should suggest quoting it: %+v", f)
+	}
+}
+
+func TestSchemaDraft(t *testing.T) {
+	defer func(d string) { SchemaDraft = d }(SchemaDraft)
+
+	var schema interface{}
+	json.Unmarshal([]byte(`{
+		"properties": {
+			"id": {"$ref": "#/$defs/id", "maxLength": 2},
+			"tags": {"prefixItems": [{"type": "string"}], "items": {"type": "number"}},
+			"pair": {"items": [{"type": "string"}], "additionalItems": {"type": "number"}}
+		},
+		"$defs": {"id": {"type": "string"}}
+	}`), &schema)
+
+	v := map[string]interface{}{
+		"id":   "abc",
+		"tags": []interface{}{"a", "b"},
+		"pair": []interface{}{"a", "b"},
+	}
+
+	for _, test := range []struct {
+		Draft    string
+		Pointers []string
+	}{
+		{"draft7", []string{"/pair/1", "/tags/0", "/tags/1"}},
+		{"2020-12", []string{"/id", "/tags/1"}},
+	} {
+		SchemaDraft = test.Draft
+
+		var pointers []string
+		for _, e := range SchemaErrors(context.Background(), schema, schema, v, "") {
+			pointers = append(pointers, e.Pointer)
+		}
+		sort.Strings(pointers)
+
+		if !reflect.DeepEqual(pointers, test.Pointers) {
+			t.Errorf("Under %s the errors should be at %v, got %v", test.Draft, test.Pointers, pointers)
+		}
+	}
+}
+
+func TestHeaderCasing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(HandleServer))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// written by hand, since a Go client would canonicalize the names itself
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Accept: application/json\r\n"+
+		"Content-Length: 0\r\n"+
+		"Connection: close\r\n"+
+		"ce-SpecVersion: 1.0\r\n"+
+		"ce-Type: t\r\n"+
+		"ce-ID: 1\r\n"+
+		"ce-Source: /s\r\n"+
+		"ce-Some_Typo: x\r\n"+
+		"\r\n")
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var result Result
+	json.NewDecoder(res.Body).Decode(&result)
+
+	// the server only sees the canonical form of the name
+	findings := result.Findings
+	if len(findings) != 1 || findings[0].Attribute != "some_typo" || !strings.HasPrefix(findings[0].Message, "HTTP header `Ce-Some_typo`") {
+		t.Errorf("The finding should name the header in canonical form: %+v", findings)
+	}
+}
+
+func TestSampleInvalid(t *testing.T) {
+	if r := VerifyJSON(SampleEvent()); r != "" {
+		t.Errorf("The sample event should be valid: %s", r)
+	}
+
+	for _, d := range Defects {
+		j, err := SampleInvalidEvent(d.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// as printed and read back
+		b, _ := json.Marshal(j)
+		if j, err = ParseEvent(b, false); err != nil {
+			t.Fatal(err)
+		}
+
+		if f := Verify(j); len(f) != 1 || f[0].Code != d.Code {
+			t.Errorf("Sample %s should only be reported as %s: %+v", d.Name, d.Code, f)
+		}
+	}
+
+	if _, err := SampleInvalidEvent("typo"); err == nil || !strings.Contains(err.Error(), "missing-id") {
+		t.Errorf("An unknown defect should fail naming the known ones: %v", err)
+	}
+}
+
+func TestValidateXMLData(t *testing.T) {
+	defer func(v bool) { ValidateXMLData = v }(ValidateXMLData)
+
+	j := map[string]interface{}{
+		"specversion":     "1.0",
+		"type":            "t",
+		"id":              "1",
+		"source":          "/s",
+		"datacontenttype": "application/xml",
+		"data":            "<much>\n<wow></much>",
+	}
+
+	ValidateXMLData = false
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("XML data should only be parsed with -validate-xml-data: %s", r)
+	}
+
+	ValidateXMLData = true
+	if f := Verify(j); len(f) != 1 || f[0].Code != InvalidXML || !strings.Contains(f[0].Message, "line 2") {
+		t.Errorf("Malformed XML data was not reported with its position: %+v", f)
+	}
+
+	for _, data := range []interface{}{"", "just text"} {
+		j["data"] = data
+		if f := Verify(j); len(f) != 1 || f[0].Code != InvalidXML {
+			t.Errorf("XML data %q without a root element was not reported: %+v", data, f)
+		}
+	}
+
+	for _, data := range []string{"<a/><b/>", "<a/>\n<!-- b -->\n<b></b>"} {
+		j["data"] = data
+		if f := Verify(j); len(f) != 1 || f[0].Code != InvalidXML || !strings.Contains(f[0].Message, "second root element") {
+			t.Errorf("XML data %q with a second root element was not reported: %+v", data, f)
+		}
+	}
+
+	for _, data := range []string{"<a/>trailing", "leading<a/>"} {
+		j["data"] = data
+		if f := Verify(j); len(f) != 1 || f[0].Code != InvalidXML || !strings.Contains(f[0].Message, "text outside the root element") {
+			t.Errorf("XML data %q with text outside the root element was not reported: %+v", data, f)
+		}
+	}
+
+	j["data"] = []byte("<?xml version=\"1.0\"?>\n<much><wow/></much>\n<!-- done -->\n")
+	j["datacontenttype"] = "application/atom+xml; charset=utf-8"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Well-formed XML data should be valid: %s", r)
+	}
+
+	j["data"] = "<much>"
+	j["datacontenttype"] = "text/plain"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Data that is not declared as XML should not be parsed: %s", r)
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	events := []map[string]interface{}{
+		{"specversion": "1.0", "type": "b", "id": "1", "source": "/s"},
+		{"specversion": "1.0", "type": "a", "id": "2", "source": "/s"},
+		{"specversion": "1.0", "type": "b", "source": "/s"},
+		{"specversion": "1.0", "type": "b", "id": "4", "source": "/t"},
+		{"specversion": "1.0", "id": "5", "source": "/t"},
+	}
+	result := NewBatchResult(context.Background(), events, nil)
+
+	expected := []GroupCount{{"", 0, 1}, {"a", 1, 0}, {"b", 2, 1}}
+	if groups := GroupCounts(events, result, "type"); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Grouped by type should be %+v, got %+v", expected, groups)
+	}
+
+	expected = []GroupCount{{"/s", 2, 1}, {"/t", 1, 1}}
+	if groups := GroupCounts(events, result, "source"); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Grouped by source should be %+v, got %+v", expected, groups)
+	}
+}
+
+func TestMaxHeaders(t *testing.T) {
+	defer func(m int) { MaxHeaders = m }(MaxHeaders)
+	MaxHeaders = 10
+
+	post := func(n int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Add("ce-specversion", "1.0")
+		req.Header.Add("ce-type", "t")
+		req.Header.Add("ce-id", "1")
+		req.Header.Add("ce-source", "/s")
+		for i := 4; i < n; i++ {
+			req.Header.Add("ce-ext"+strconv.Itoa(i), "x")
+		}
+
+		rr := httptest.NewRecorder()
+		HandleServer(rr, req)
+		return rr
+	}
+
+	if rr := post(10); rr.Code != http.StatusOK {
+		t.Errorf("A request with -max-headers ce- headers should be accepted, got %d: %s", rr.Code, rr.Body)
+	}
+
+	if rr := post(1000); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "too many ce- headers (1000, maximum is 10)") {
+		t.Errorf("A request with too many ce- headers should be rejected, got %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestIDWindow(t *testing.T) {
+	defer func(n int) { IDWindowSize = n }(IDWindowSize)
+	IDWindowSize = 2
+
+	var lines []string
+	for _, e := range [][2]string{{"/a", "1"}, {"/b", "1"}, {"/a", "1"}, {"/a", "2"}, {"/b", "3"}, {"/a", "2"}, {"/b", "1"}} {
+		lines = append(lines, `{"specversion":"1.0","type":"t","source":"`+e[0]+`","id":"`+e[1]+`"}`)
+	}
+
+	var out bytes.Buffer
+	codes, n, err := VerifyStream(context.Background(), strings.NewReader(strings.Join(lines, "\n")), &out, false)
+	if err != nil || n != 7 {
+		t.Fatalf("The stream should have been verified (%d events): %v", n, err)
+	}
+
+	if !reflect.DeepEqual(codes, []string{DuplicateID}) {
+		t.Errorf("Only duplicate ids should be reported: %v", codes)
+	}
+
+	// /a 1 is reused 2 events later and /a 2 likewise, /b 1 only 5 events later
+	for _, s := range []string{"Event 2:\nAttribute `id` \"1\" was already used by event 0 of the same source, 2 events earlier", "Event 5:\nAttribute `id` \"2\" was already used by event 3"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("The report should contain %q:\n%s", s, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "Event 6:") {
+		t.Errorf("An id reused outside the window should not be reported:\n%s", out.String())
+	}
+	// -o json and -strict verify the stream as a batch
+	events, _, err := ParseInput(strings.NewReader(strings.Join(lines, "\n")), "ndjson", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := NewBatchResult(context.Background(), events, nil)
+	if result.Valid {
+		t.Errorf("A batch with reused ids should be invalid")
+	}
+	for i, r := range result.Events {
+		var expected []string
+		if i == 2 || i == 5 {
+			expected = []string{DuplicateID}
+		}
+		if codes := FindingCodes(nil, r.Findings); !reflect.DeepEqual(codes, expected) {
+			t.Errorf("Event %d of the batch was reported with %v", i, codes)
+		}
+	}
+}
+
+func TestMediaTypeCase(t *testing.T) {
+	for _, v := range []string{"Application/JSON", "APPLICATION/json", "Text/Plain; Charset=UTF-8", "message/CPIM"} {
+		j := map[string]interface{}{
+			"specversion":     "1.0",
+			"type":            "t",
+			"id":              "1",
+			"source":          "/s",
+			"datacontenttype": v,
+			"data":            "a",
+		}
+
+		if r := VerifyJSON(j); r != "" {
+			t.Errorf("Media type %q should be valid regardless of case: %s", v, r)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"1.0","type":"t","id":"1","source":"/s"}`))
+	req.Header.Add("Content-Type", "Application/CloudEvents+JSON")
+
+	rr := httptest.NewRecorder()
+	HandleServer(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("An uppercase structured mode Content-Type should be accepted, got %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestTrailers(t *testing.T) {
+	defer func(r bool) { ReadTrailers = r }(ReadTrailers)
+
+	server := httptest.NewServer(http.HandlerFunc(HandleServer))
+	defer server.Close()
+
+	post := func(trailer http.Header) *http.Response {
+		// a body of unknown length is chunked, which is what carries trailers
+		req, _ := http.NewRequest("POST", server.URL, ioutil.NopCloser(strings.NewReader("data")))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("ce-specversion", "1.0")
+		req.Header.Set("ce-type", "t")
+		req.Header.Set("ce-source", "/s")
+		req.Trailer = trailer
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	ReadTrailers = false
+	if resp := post(http.Header{"Ce-Id": {"1"}}); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Trailers should only be read with -trailer, got %s", resp.Status)
+	}
+
+	ReadTrailers = true
+	if resp := post(http.Header{"Ce-Id": {"1"}}); resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		t.Errorf("The id of a trailer should have been used, got %s: %s", resp.Status, body)
+	}
+
+	resp := post(http.Header{"Ce-Id": {"1"}, "Ce-Source": {"/other"}})
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(string(body), "HTTP trailer `Ce-Source` is \"/other\" but header `Ce-Source` is \"/s\"") {
+		t.Errorf("A trailer conflicting with a header should be reported, got %s: %s", resp.Status, body)
+	}
+}
+
+func TestEmptyObject(t *testing.T) {
+	defer func(s bool) { Strict = s }(Strict)
+
+	expected := []Finding{
+		{MissingRequired, "id", "Attribute `id` is missing."},
+		{MissingRequired, "source", "Attribute `source` is missing."},
+		{MissingRequired, "specversion", "Attribute `specversion` is missing."},
+		{MissingRequired, "type", "Attribute `type` is missing."},
+	}
+
+	for _, Strict = range []bool{false, true} {
+		for i := 0; i < 10; i++ {
+			if f := Verify(map[string]interface{}{}); !reflect.DeepEqual(f, expected) {
+				t.Fatalf("An empty object should only be missing the required attributes in order (strict %t): %+v", Strict, f)
+			}
+		}
+
+		if r := VerifyJSON(map[string]interface{}{}); r != FormatFindings(expected) {
+			t.Errorf("An empty object should be reported as:\n%s\ngot:\n%s", FormatFindings(expected), r)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	req.Header.Add("Content-Type", "application/cloudevents+json")
+	req.Header.Add("Accept", "application/json")
+
+	rr := httptest.NewRecorder()
+	HandleServer(rr, req)
+
+	var result Result
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || rr.Code != http.StatusUnprocessableEntity || !reflect.DeepEqual(result.Findings, expected) {
+		t.Errorf("Posting an empty object should respond with the missing attributes, got %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	defer func(r bool, e bool, v bool) { Redact, EchoAttributes, ValidateXMLData = r, e, v }(Redact, EchoAttributes, ValidateXMLData)
+	Redact = true
+	EchoAttributes = true
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"1.0","type":"t","id":"1","source":"/s","data":"secret"}`))
+	req.Header.Add("Content-Type", "application/cloudevents+json")
+	req.Header.Add("Accept", "application/json")
+
+	rr := httptest.NewRecorder()
+	HandleServer(rr, req)
+
+	if strings.Contains(rr.Body.String(), "secret") || !strings.Contains(rr.Body.String(), `"data":"[redacted 6 bytes]"`) {
+		t.Errorf("The echoed data should be redacted: %s", rr.Body)
+	}
+
+	var out, log bytes.Buffer
+	if _, err := Pipe(strings.NewReader(`{"specversion":"1.0","type":"t","id":"1","source":"/s","data_base64":"c2VjcmV0"}`), &out, &log); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "c2VjcmV0") || !strings.Contains(out.String(), "[redacted 8 bytes]") {
+		t.Errorf("The piped data should be redacted: %s", out.String())
+	}
+
+	ValidateXMLData = true
+	j := map[string]interface{}{"specversion": "1.0", "type": "t", "id": "1", "source": "/s", "datacontenttype": "application/xml", "data": "<secret></other>"}
+	if f := Verify(j); len(f) != 1 || strings.Contains(f[0].Message, "secret") || !strings.Contains(f[0].Message, "details redacted") {
+		t.Errorf("The finding should not quote the data: %+v", f)
+	}
+}
+
+func TestNumericID(t *testing.T) {
+	for _, v := range []interface{}{1234.0, json.Number("1234")} {
+		j := map[string]interface{}{
+			"specversion": "1.0",
+			"type":        "t",
+			"id":          v,
+			"source":      "/s",
+		}
+
+		if f := Verify(j); len(f) != 1 || f[0].Code != WrongType || f[0].Message != "Attribute `id` is not of type String (is currently the number 1234, quote it as \"1234\")" {
+			t.Errorf("A numeric id %#v should be reported with a suggestion to quote it: %+v", v, f)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	defer func(r *Registry) { EventRegistry = r }(EventRegistry)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"types": {
+			"com.example.order": {"schema": {"type": "object", "required": ["orderId"]}},
+			"com.example.ping": {}
+		}}`))
+	}))
+	defer server.Close()
+
+	var err error
+	if EventRegistry, err = LoadRegistry(server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "com.example.order",
+		"id":          "1",
+		"source":      "/s",
+		"data":        map[string]interface{}{"orderId": "a"},
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("A registered event with matching data should be valid: %s", r)
+	}
+
+	j["data"] = []byte(`{"id": "a"}`)
+	if f := Verify(j); len(f) != 1 || f[0].Code != SchemaViolation || f[0].Attribute != "data" || !strings.Contains(f[0].Message, `"orderId"`) {
+		t.Errorf("Data not matching the registered schema was not reported: %+v", f)
+	}
+
+	j["type"] = "com.example.ping"
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("A registered type without a schema should allow any data: %s", r)
+	}
+
+	j["type"] = "com.example.unknown"
+	if f := Verify(j); len(f) != 1 || f[0].Code != UnregisteredType || f[0].Attribute != "type" {
+		t.Errorf("An unregistered type was not reported: %+v", f)
+	}
+
+	if requests != 1 {
+		t.Errorf("The registry should be fetched once, was fetched %d times", requests)
+	}
+}
+
+func TestServerMalformedOrInvalid(t *testing.T) {
+	contentType := "application/cloudevents+json"
+	post := func(body string) (int, Result) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Add("Content-Type", contentType)
+		}
+		req.Header.Add("Accept", "application/json")
+
+		rr := httptest.NewRecorder()
+		HandleServer(rr, req)
+
+		var result Result
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+			t.Fatalf("The response should be JSON: %s", rr.Body)
+		}
+		return rr.Code, result
+	}
+
+	if code, result := post(`{"specversion":"1.0",`); code != http.StatusBadRequest || result.Error == "" || len(result.Findings) != 0 {
+		t.Errorf("Malformed JSON should be answered with 400 and an error, got %d: %+v", code, result)
+	}
+
+	if code, result := post(`{"specversion":"1.0","type":"t","source":"/s"}`); code != http.StatusUnprocessableEntity || result.Error != "" || len(result.Findings) != 1 {
+		t.Errorf("An invalid event should be answered with 422 and its findings, got %d: %+v", code, result)
+	}
+
+	if code, _ := post(`{"specversion":"1.0","type":"t","id":"1","source":"/s"}`); code != http.StatusOK {
+		t.Errorf("A valid event should be answered with 200, got %d", code)
+	}
+
+	// the documented exceptions, which carry a finding instead of an error
+	contentType = ""
+	if code, result := post(`{"specversion":"1.0","type":"t","id":"1","source":"/s"}`); code != http.StatusBadRequest || result.Error != "" || len(result.Findings) != 1 || result.Findings[0].Code != MissingContentType {
+		t.Errorf("A body without Content-Type should be answered with 400 and a finding, got %d: %+v", code, result)
+	}
+
+	contentType = "application/cloudevents+xml"
+	if code, result := post(`<event/>`); code != http.StatusUnsupportedMediaType || result.Error != "" || len(result.Findings) != 1 || result.Findings[0].Code != UnsupportedFormat {
+		t.Errorf("An unsupported format should be answered with 415 and a finding, got %d: %+v", code, result)
+	}
+}
+
+func TestOutputAttributes(t *testing.T) {
+	events := []map[string]interface{}{
+		{"specversion": "1.0", "type": "t", "id": "1", "source": "/s", "data": "a"},
+		{"specversion": "1.0", "type": "t", "source": "/s"},
+		{"specversion": "1.0", "type": "u", "id": "3", "source": "/s", "subject": "x"},
+	}
+
+	var out, log bytes.Buffer
+	if skipped := WriteProjections(events, []string{"id", "type", "subject"}, &out, &log); skipped != 1 {
+		t.Errorf("One invalid event should have been skipped, %d were", skipped)
+	}
+
+	var projections []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var p map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &p); err != nil {
+			t.Fatalf("Each projection should be a JSON line: %q", line)
+		}
+		projections = append(projections, p)
+	}
+
+	expected := []map[string]interface{}{
+		{"id": "1", "type": "t"},
+		{"id": "3", "type": "u", "subject": "x"},
+	}
+	if !reflect.DeepEqual(projections, expected) {
+		t.Errorf("The projections should be %v, got %v", expected, projections)
+	}
+
+	if !strings.Contains(log.String(), "Event 1 skipped:\nAttribute `id` is missing.") {
+		t.Errorf("The invalid event should be logged: %s", log.String())
+	}
+
+	defer func(r bool) { Redact = r }(Redact)
+	Redact = true
+
+	if p := Project(events[0], []string{"id", "data"}); !reflect.DeepEqual(p, map[string]interface{}{"id": "1", "data": "[redacted 1 bytes]"}) {
+		t.Errorf("Projected data should be redacted with -redact, got %v", p)
+	}
+}
+
+func TestTimeSentinel(t *testing.T) {
+	defer func(s bool) { Strict = s }(Strict)
+
+	for _, v := range []string{"0001-01-01T00:00:00Z", "1970-01-01T00:00:00Z", "1970-01-01T01:00:00+01:00"} {
+		j := map[string]interface{}{
+			"specversion": "1.0",
+			"type":        "t",
+			"id":          "1",
+			"source":      "/s",
+			"time":        v,
+		}
+
+		Strict = false
+		if r := VerifyJSON(j); r != "" {
+			t.Errorf("Time %s should be valid without strict mode: %s", v, r)
+		}
+
+		Strict = true
+		if f := Verify(j); len(f) != 1 || f[0].Code != SentinelTime || !strings.Contains(f[0].Message, strconv.Quote(v)) {
+			t.Errorf("Time %s should be reported as a sentinel: %+v", v, f)
+		}
+	}
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+		"time":        "1970-01-01T00:00:01Z",
+	}
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Other times should be valid in strict mode: %s", r)
+	}
+}
+
+func TestGenerateVectors(t *testing.T) {
+	defer func(s bool) { Strict = s }(Strict)
+	names := make(map[string]bool)
+
+	for _, v := range GenerateVectors() {
+		if names[v.Name] {
+			t.Errorf("Vector %s is generated twice", v.Name)
+		}
+		names[v.Name] = true
+
+		Strict = v.Strict
+		findings := Verify(v.Event)
+		if v.Valid {
+			if len(findings) > 0 {
+				t.Errorf("Vector %s should be valid: %+v", v.Name, findings)
+			}
+			continue
+		}
+
+		if codes := FindingCodes(nil, findings); !reflect.DeepEqual(codes, []string{v.Code}) {
+			t.Errorf("Vector %s should be reported with %s only, got %v", v.Name, v.Code, codes)
+		}
+	}
+
+	for _, e := range Attributes {
+		if !names["wrong-type-"+e.Name] {
+			t.Errorf("There should be a vector for every attribute, %s has none", e.Name)
+		}
+	}
+
+	for _, c := range EventChecks {
+		if c.Flag == "" && !names[strings.Replace(c.Code, "_", "-", -1)] {
+			t.Errorf("There should be a vector for every check that needs no flag, %q has none", c.Name)
+		}
+	}
+}
+
+func TestResponseContentType(t *testing.T) {
+	defer func(d bool) { Debug = d }(Debug)
+	Debug = true
+
+	event := `{"specversion":"1.0","type":"t","id":"1","source":"/s"}`
+	tests := []struct {
+		method, path, body, accept, expected string
+	}{
+		{"GET", "/", "", "", "text/html; charset=utf-8"},
+		{"POST", "/", event, "", "text/plain; charset=utf-8"},
+		{"POST", "/", event, "application/json", "application/json"},
+		{"POST", "/", `{"specversion":"1.0"}`, "", "text/plain; charset=utf-8"},
+		{"POST", "/", "{", "application/json", "application/json"},
+		{"POST", "/debug/headers", "", "", "application/json"},
+	}
+
+	handler := NewServer(0).Handler
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.body != "" {
+			req.Header.Set("Content-Type", "application/cloudevents+json")
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if c := rr.Header().Get("Content-Type"); c != test.expected {
+			t.Errorf("%s %s with %q should be answered with Content-Type %q, got %q", test.method, test.path, test.body, test.expected, c)
+		}
+	}
+}
+
+func TestSSE(t *testing.T) {
+	defer func(o string) { Output = o }(Output)
+	Output = "jsonl"
+
+	input := ": keep-alive\n" +
+		"event: cloudevent\n" +
+		"id: 1\n" +
+		"data: {\"specversion\":\"1.0\",\"id\":\"1\",\"type\":\"t\",\"source\":\"/s\"}\n" +
+		"\n" +
+		"data: {\"specversion\": \"1.0\",\n" +
+		"data:  \"id\": \"2\",\n" +
+		"data: \"type\": \"t\"}\r\n" +
+		"\r\n" +
+		"retry: 1000\n" +
+		"\n" +
+		"data: {\"specversion\":\"1.0\",\"id\":\"3\",\"type\":\"t\",\"source\":\"/cut-off\"}\n"
+
+	var out bytes.Buffer
+	codes, n, err := VerifyScanned(context.Background(), ScanSSE, strings.NewReader(input), &out, true)
+	if err != nil || n != 2 || !reflect.DeepEqual(codes, []string{MissingRequired}) {
+		t.Fatalf("Verifying the SSE stream returned %v, %d, %v:\n%s", codes, n, err, out.String())
+	}
+
+	var results []LineResult
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var r LineResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("Each event should be reported as a JSON line: %q", line)
+		}
+		results = append(results, r)
+	}
+
+	if len(results) != 2 || results[0].ID != "1" || !results[0].Valid || results[1].ID != "2" || results[1].Valid {
+		t.Errorf("The frames were not verified event by event: %+v", results)
+	}
+
+	// a malformed frame fails as an event of its own and the stream goes on
+	out.Reset()
+	input = "data: {\"specversion\":\"1.0\",\"id\":\"1\",\"type\":\"t\",\"source\":\"/s\"}\n\n" +
+		"data: {\n\n" +
+		"data: {\"specversion\":\"1.0\",\"id\":\"3\",\"type\":\"t\"}\n\n"
+
+	codes, n, err = VerifyScanned(context.Background(), ScanSSE, strings.NewReader(input), &out, true)
+	if err == nil || err.Error() != "1 of 3 events could not be parsed" || n != 3 || !reflect.DeepEqual(codes, []string{MissingRequired}) {
+		t.Fatalf("Verifying a stream with a malformed frame returned %v, %d, %v:\n%s", codes, n, err, out.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var malformed LineResult
+	json.Unmarshal([]byte(lines[1]), &malformed)
+	if len(lines) != 3 || malformed.Valid || !strings.Contains(malformed.Error, "event ending on line 4") || !strings.Contains(lines[2], `"id":"3"`) {
+		t.Errorf("The malformed frame should be reported in place of its event:\n%s", out.String())
+	}
+}
+
+func TestOpenSSE(t *testing.T) {
+	defer func(d time.Duration, n int64) { ReadTimeout, MaxBodySize = d, n }(ReadTimeout, MaxBodySize)
+	ReadTimeout = 100 * time.Millisecond
+	MaxBodySize = 200
+
+	frame := "data: {\"specversion\":\"1.0\",\"id\":\"1\",\"type\":\"t\",\"source\":\"/s\"}\n\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/silent":
+			time.Sleep(3 * ReadTimeout)
+		case "/slow":
+			// the headers are in time, the stream may then take longer
+			w.Write([]byte(frame))
+			w.(http.Flusher).Flush()
+			time.Sleep(3 * ReadTimeout)
+			w.Write([]byte(frame))
+		case "/endless":
+			for i := 0; i < 10; i++ {
+				w.Write([]byte(frame))
+			}
+		}
+	}))
+	defer srv.Close()
+
+	if body, err := OpenSSE(srv.URL + "/silent"); err == nil {
+		body.Close()
+		t.Error("A server that does not answer within -read-timeout should fail")
+	}
+
+	body, err := OpenSSE(srv.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, n, err := VerifyScanned(context.Background(), ScanSSE, body, ioutil.Discard, true)
+	body.Close()
+	if err != nil || n != 2 {
+		t.Errorf("A stream outlasting -read-timeout returned %d events and %v", n, err)
+	}
+
+	body, err = OpenSSE(srv.URL + "/endless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyScanned(context.Background(), ScanSSE, body, ioutil.Discard, true)
+	body.Close()
+	if err == nil || !strings.Contains(err.Error(), ErrBodyTooLarge.Error()) {
+		t.Errorf("A stream longer than -max-body-size should fail, got %v", err)
+	}
+}
+
+func TestPresentButInvalidRequired(t *testing.T) {
+	for _, test := range []struct {
+		id   interface{}
+		code string
+	}{
+		{nil, NullValue},
+		{"", EmptyString},
+		{true, WrongType},
+	} {
+		j := map[string]interface{}{
+			"specversion": "1.0",
+			"type":        "t",
+			"id":          test.id,
+			"source":      "/s",
+		}
+
+		if f := Verify(j); len(f) != 1 || f[0].Code != test.code || f[0].Attribute != "id" {
+			t.Errorf("An `id` of %#v should only be reported as %s, got %+v", test.id, test.code, f)
+		}
+	}
+
+	findings := []Finding{
+		{MissingRequired, "id", "Attribute `id` is missing."},
+		{NullValue, "id", "Attribute `id` cannot be null."},
+		{SchemaViolation, "data", "a"},
+		{SchemaViolation, "data", "b"},
+		{SchemaViolation, "data", "a"},
+	}
+	expected := []Finding{findings[1], findings[2], findings[3]}
+	if f := DeduplicateFindings(findings); !reflect.DeepEqual(f, expected) {
+		t.Errorf("Expected the findings %+v, got %+v", expected, f)
+	}
+}
+
+func TestMaxFindings(t *testing.T) {
+	defer func(m int) { MaxFindings = m }(MaxFindings)
+
+	j := map[string]interface{}{"specversion": "1.0", "type": "t", "id": "1", "source": "/s"}
+	for i := 0; i < 10; i++ {
+		j["Bad"+strconv.Itoa(i)] = "x"
+	}
+
+	MaxFindings = 0
+	if f := Verify(j); len(f) != 10 {
+		t.Errorf("Every finding should be reported by default, got %d", len(f))
+	}
+
+	MaxFindings = 3
+	f := NewResult(Verify(j)).Findings
+	if len(f) != 4 || f[0].Code != BadExtensionName || f[2].Code != BadExtensionName {
+		t.Fatalf("Expected 3 findings and the truncation, got %+v", f)
+	}
+	if f[3].Code != Truncated || f[3].Message != "...and 7 more" {
+		t.Errorf("The rest of the findings should be counted, got %+v", f[3])
+	}
+
+	j = map[string]interface{}{"specversion": "1.0", "type": "t", "source": "/s"}
+	if f := NewResult(Verify(j)).Findings; len(f) != 1 || f[0].Code != MissingRequired {
+		t.Errorf("Fewer findings than the maximum should not be truncated, got %+v", f)
+	}
+
+	// the codes of -assert-invalid include those of the truncated findings
+	MaxFindings = 1
+	result := NewBatchResult(context.Background(), []map[string]interface{}{{"specversion": "1.0", "type": "t", "source": "/s", "Bad": "x"}}, nil)
+	if f := result.Events[0].Findings; len(f) != 2 || f[1].Code != Truncated {
+		t.Errorf("Expected 1 finding and the truncation, got %+v", f)
+	}
+	if codes := ResultCodes(result); !reflect.DeepEqual(codes, []string{MissingRequired, BadExtensionName}) {
+		t.Errorf("The codes should include the truncated findings, got %v", codes)
+	}
+
+	// the findings of the binary mode are capped along with the others
+	req := httptest.NewRequest("POST", "/", strings.NewReader("data"))
+	req.Header.Add("Content-Type", "text/plain")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("ce-specversion", "1.0")
+	req.Header.Add("ce-type", "t")
+	req.Header.Add("ce-source", "/s")
+	req.Header.Add("ce-datacontenttype", "text/plain")
+
+	rr := httptest.NewRecorder()
+	HandleServer(rr, req)
+
+	var response Result
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if len(response.Findings) != 2 || response.Findings[1].Code != Truncated {
+		t.Errorf("The server should report 1 finding and the truncation, got %s", rr.Body)
+	}
+}
+
+func TestSourceSubjectLength(t *testing.T) {
+	defer func(m int) { MaxSourceSubjectLength = m }(MaxSourceSubjectLength)
+
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/orders",
+		"subject":     "order-1234",
+	}
+
+	MaxSourceSubjectLength = 0
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("The combined length should not be checked by default: %s", r)
+	}
+
+	MaxSourceSubjectLength = 17
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("A combined length of the maximum should be valid: %s", r)
+	}
+
+	MaxSourceSubjectLength = 16
+	if f := Verify(j); len(f) != 1 || f[0].Code != TooLong || f[0].Attribute != "subject" || !strings.Contains(f[0].Message, "(7 + 10 = 17 characters, maximum is 16)") {
+		t.Errorf("The combined length was not reported: %+v", f)
+	}
+}
+
+func TestJSONPointerErrors(t *testing.T) {
+	body := "{\n  \"specversion\": \"1.0\",\n  \"id\": \"\",\n  \"source\": \"/s\",\n  \"type\": \"t\",\n  \"a/b\": [1, {\"c\": true}]\n}"
+
+	spans, err := Spans([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p, text := range map[string]string{
+		"":          body,
+		"/id":       `"id": ""`,
+		"/type":     `"type": "t"`,
+		"/a~1b":     `"a/b": [1, {"c": true}]`,
+		"/a~1b/0":   `1`,
+		"/a~1b/1":   `{"c": true}`,
+		"/a~1b/1/c": `"c": true`,
+	} {
+		if span, ok := spans[p]; !ok || body[span.Start:span.End] != text {
+			t.Errorf("The span of %q should be %q, got %+v", p, text, span)
+		}
+	}
+
+	j, _ := ParseEvent([]byte(body), false)
+	located := LocateFindings(Verify(j), "", spans)
+	if len(located) != 2 {
+		t.Fatalf("Expected 2 findings, got %+v", located)
+	}
+
+	if f := located[0]; f.Code != EmptyString || f.Pointer != "/id" || *f.Span != (Span{28, 36}) {
+		t.Errorf("The empty id should be located at bytes 28-36, got %+v %+v", f, f.Span)
+	}
+	if f := located[1]; f.Code != BadExtensionName || f.Pointer != "/a~1b" || *f.Span != (Span{73, 96}) {
+		t.Errorf("The bad extension name should be located at bytes 73-96, got %+v %+v", f, f.Span)
+	}
+
+	body = `{"specversion": "1.0", "type": "t", "source": "/s"}`
+	spans, _ = Spans([]byte(body))
+	j, _ = ParseEvent([]byte(body), false)
+	if f := LocateFindings(Verify(j), "", spans); len(f) != 1 || f[0].Span != nil || f[0].Pointer != "" {
+		t.Errorf("A missing attribute has no span, got %+v", f)
+	}
+}
+
+func TestPercentEncoding(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/my%20context/%C3%A9",
+	}
+
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("Percent-encoded octets should be valid in `source`: %s", r)
+	}
+
+	for source, escape := range map[string]string{
+		"/my%zzcontext": `"%zz" at character 3`,
+		"/context%2":    `"%2" at character 8`,
+		"/context%":     `"%" at character 8`,
+	} {
+		j["source"] = source
+		if f := Verify(j); len(f) != 1 || f[0].Code != InvalidURI || !strings.Contains(f[0].Message, "invalid percent-encoding "+escape) {
+			t.Errorf("The invalid percent-encoding of %q was not reported: %+v", source, f)
+		}
+	}
+
+	j["source"] = "/my context/%zz/%2f/é"
+	j["dataschema"] = "https://example.com/100%"
+	FixEvent(j)
+
+	if j["source"] != "/my%20context/%25zz/%2F/%C3%A9" || j["dataschema"] != "https://example.com/100%25" {
+		t.Errorf("The URIs were not percent-encoded: %v %v", j["source"], j["dataschema"])
+	}
+	if r := VerifyJSON(j); r != "" {
+		t.Errorf("The fixed event should be valid: %s", r)
+	}
+}
+
+func TestRequestDump(t *testing.T) {
+	// as sent by the Go SDK in binary mode
+	dump := "POST / HTTP/1.1\r\n" +
+		"Host: localhost:8080\r\n" +
+		"User-Agent: Go-http-client/1.1\r\n" +
+		"Content-Length: 17\r\n" +
+		"Ce-Id: 7a0dc520-c870-4193-8c8a-1e1a3bf9b3d9\r\n" +
+		"Ce-Source: https://github.com/cloudevents/sdk-go/v2/samples/requester\r\n" +
+		"Ce-Specversion: 1.0\r\n" +
+		"Ce-Time: 2021-03-02T10:56:40.1436382Z\r\n" +
+		"Ce-Type: com.cloudevents.sample.sent\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Accept-Encoding: gzip\r\n" +
+		"\r\n" +
+		`{"id":0,"m":"a"}` + "\n"
+
+	rr, err := VerifyRequestDump(strings.NewReader(dump))
+	if err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("The SDK's request should be valid: %v %v", err, rr)
+	}
+
+	rr, err = VerifyRequestDump(strings.NewReader(strings.Replace(dump, "Ce-Specversion: 1.0\r\n", "", 1)))
+	if err != nil || rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "`specversion` is missing") {
+		t.Errorf("The request without specversion should be invalid: %v %d %s", err, rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("The headers of the answer should be kept, got Content-Type %q", ct)
+	}
+
+	if _, err := VerifyRequestDump(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err == nil {
+		t.Errorf("Only POST requests carry events")
+	}
+}
+
+func TestCORS(t *testing.T) {
+	defer func(o []string) { CORSOrigins = o }(CORSOrigins)
+
+	preflight := func() *http.Request {
+		req := httptest.NewRequest("OPTIONS", "/", nil)
+		req.Header.Set("Origin", "https://composer.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type, ce-id, ce-source")
+		return req
+	}
+
+	CORSOrigins = nil
+	rr := httptest.NewRecorder()
+	NewServer(0).Handler.ServeHTTP(rr, preflight())
+	if rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("CORS should be disabled by default: %v", rr.Header())
+	}
+
+	CORSOrigins = []string{"https://composer.example.com"}
+	rr = httptest.NewRecorder()
+	NewServer(0).Handler.ServeHTTP(rr, preflight())
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":  "https://composer.example.com",
+		"Access-Control-Allow-Methods": "GET, HEAD, POST, OPTIONS",
+		"Access-Control-Allow-Headers": "content-type, ce-id, ce-source",
+		"Access-Control-Max-Age":       "600",
+		"Vary":                         "Origin",
+	}
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("The preflight should be answered with %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	for k, v := range expected {
+		if h := rr.Header().Get(k); h != v {
+			t.Errorf("Header %s of the preflight should be %q, got %q", k, v, h)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"specversion":"1.0","type":"t","id":"1","source":"/s"}`))
+	req.Header.Set("Origin", "https://composer.example.com")
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	rr = httptest.NewRecorder()
+	NewServer(0).Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "https://composer.example.com" {
+		t.Errorf("The event should be verified for the allowed origin: %d %v", rr.Code, rr.Header())
+	}
+
+	req = preflight()
+	req.Header.Set("Origin", "https://other.example.com")
+	rr = httptest.NewRecorder()
+	NewServer(0).Handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "" || rr.Code == http.StatusNoContent {
+		t.Errorf("Other origins should not be allowed: %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestStrictJSON(t *testing.T) {
+	defer func(s bool) { StrictJSON = s }(StrictJSON)
+
+	event := `{"specversion":"1.0","type":"t","id":"1","source":"/s"`
+	tests := []struct {
+		body, err string
+	}{
+		{event + ",\"subject\":\"a\xffb\"}", "invalid UTF-8 at byte 67"},
+		{event + `,"subject":"\ud800"}`, `unpaired surrogate \ud800 at byte 66`},
+		{event + `,"subject":"\udc00\ud83d"}`, `unpaired surrogate \udc00 at byte 66`},
+		{event + `,"id":"2"}`, `duplicate key "id" at "/id"`},
+		{event + `,"data":{"a":[{"b":1,"b":2}]}}`, `duplicate key "b" at "/data/a/0/b"`},
+		{event + "}\n{}", "unexpected content after the JSON value at byte 56"},
+		{event + "} x", "unexpected content after the JSON value at byte 56"},
+	}
+
+	for _, test := range tests {
+		StrictJSON = false
+		if _, err := ParseEvent([]byte(test.body), false); err != nil {
+			t.Errorf("%q should only be rejected with -strict-json: %s", test.body, err)
+		}
+
+		StrictJSON = true
+		if _, err := ParseEvent([]byte(test.body), false); err == nil || err.Error() != test.err {
+			t.Errorf("%q should be rejected with %q, got %v", test.body, test.err, err)
+		}
+	}
+
+	StrictJSON = true
+	for _, body := range []string{
+		event + `,"subject":"😀 \\ud800 \" é"}` + "\n",
+		event + `,"data":{"id":"2","a":{"id":3}}}`,
+	} {
+		if _, err := ParseEvent([]byte(body), false); err != nil {
+			t.Errorf("%q is strict JSON: %s", body, err)
+		}
+	}
+
+	for _, body := range []string{event + `,"n":01}`, event + `,"n":NaN}`, event + `,"n":Infinity}`} {
+		StrictJSON = false
+		if _, err := ParseEvent([]byte(body), false); err == nil {
+			t.Errorf("%q should always be rejected", body)
+		}
+	}
+}
+
+func TestMinimumVersion(t *testing.T) {
+	j := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        "t",
+		"id":          "1",
+		"source":      "/s",
+	}
+	if v, ok := MinimumVersion(j); !ok || v != "0.3" {
+		t.Errorf("An event of only the required attributes should be valid since 0.3, got %q %t", v, ok)
+	}
+
+	j["dataschema"] = "https://example.com/schema"
+	if v, ok := MinimumVersion(j); !ok || v != "1.0" {
+		t.Errorf("An event with `dataschema` should require 1.0, got %q %t", v, ok)
+	}
+
+	j["schemaurl"] = "https://example.com/schema"
+	if v, ok := MinimumVersion(j); ok {
+		t.Errorf("An event with `dataschema` and `schemaurl` should be invalid under all versions, got %q", v)
+	}
+
+	delete(j, "schemaurl")
+	delete(j, "id")
+	if v, ok := MinimumVersion(j); ok {
+		t.Errorf("An event without `id` should be invalid under all versions, got %q", v)
+	}
+}